@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// file generated for benchmark if ip files are not passed
+const benchFile = "bench_ips.txt"
+
+// accumulators of values of partition stages: btrees of single ips (count) or
+// sorted slices of merged intervals (count -intervals). Addresses covered by
+// single ips are the unique ones, so both strategies give the same result
+const (
+	strategyBTree     = "btree"
+	strategyIntervals = "intervals"
+)
+
+// configuration of single benchmark run, values of count flags
+type benchConfig struct {
+	Readers     int `json:"readers"`
+	Partitions  int `json:"partitions"`
+	Elements    int `json:"elements"`
+	BTreeDegree int `json:"btree_degree"`
+	PageSize    int `json:"page_size"`
+	ReaderCache int `json:"reader_cache"`
+	ArrayCache  int `json:"array_cache"`
+	// 0 means partitions are equal ranges of ip space, otherwise bounds are
+	// sampled
+	SampleSize  int `json:"sample_size"`
+	// strategyBTree or strategyIntervals
+	Strategy    string `json:"strategy"`
+}
+
+func (c benchConfig) args() []string {
+	return []string{
+		"-readers", strconv.Itoa(c.Readers),
+		"-partitions", strconv.Itoa(c.Partitions),
+		"-elements", strconv.Itoa(c.Elements),
+		"-btree-degree", strconv.Itoa(c.BTreeDegree),
+		"-page-size", strconv.Itoa(c.PageSize),
+		"-reader-cache", strconv.Itoa(c.ReaderCache),
+		"-array-cache", strconv.Itoa(c.ArrayCache),
+		"-sample-size", strconv.Itoa(c.SampleSize),
+		"-intervals=" + strconv.FormatBool(c.Strategy == strategyIntervals),
+	}
+}
+
+type benchResult struct {
+	Config           benchConfig `json:"config"`
+	WallSec          float64     `json:"wall_sec"`
+	WriteSec         float64     `json:"write_sec"`
+	ReadSec          float64     `json:"read_sec"`
+	LinesPerSec      float64     `json:"lines_per_sec"`
+	PeakRSSBytes     uint64      `json:"peak_rss_bytes"`
+	DiskBytesWritten uint64      `json:"disk_bytes_written"`
+	Unique           uint64      `json:"unique"`
+	// false if unique count doesn't match ground truth of generated dataset
+	Correct          bool        `json:"correct"`
+}
+
+// runs count with each combination of configuration values and prints results
+// ranked by wall time
+func bench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s bench [flags] [ip files, globs, directories, archives]...\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Configuration flags accept comma separated lists of values, every combination of values is run.")
+		flags.PrintDefaults()
+	}
+
+	readers := intListFlag(flags, "readers", []int{ipReaderCount}, "counts of segments of ip files read in parallel")
+	partitions := intListFlag(flags, "partitions", []int{partitionCount}, "counts of ip space partitions")
+	elements := intListFlag(flags, "elements", []int{elementsPerStage}, "counts of values of partition kept in btrees before flushing")
+	degrees := intListFlag(flags, "btree-degree", []int{btreeDegree}, "degrees of btrees")
+	pageSizes := intListFlag(flags, "page-size", []int{ipReaderPageSize}, "min sizes of single read of ip files")
+	readerCaches := intListFlag(flags, "reader-cache", []int{ipReaderCacheSize}, "counts of parsed ips waiting to be inserted into btrees")
+	arrayCaches := intListFlag(flags, "array-cache", []int{arrayIteratorCacheSize}, "counts of values read at once from each run while merging")
+	sampleSizes := intListFlag(flags, "sample-size", []int{partitionSampleSize}, "counts of sampled ips, 0 splits ip space into equal ranges")
+	strategies := flags.String("strategy", strategyBTree, "comma separated accumulators of partition values: btree or intervals (sorted slices of merged intervals)")
+	repeat := flags.Int("repeat", 1, "count of runs of each configuration")
+	out := flags.String("o", path.Join(dataFolder, "bench.json"), "path of JSON file with results")
+
+	lines := flags.Uint64("lines", 10_000_000, "count of lines of generated dataset")
+	seed := flags.Uint64("seed", 1, "seed of generated dataset")
+	distribution := flags.String("distribution", ip.Uniform, "distribution of generated dataset: uniform, zipf, clustered or unique")
+	regenerate := flags.Bool("regenerate", false, "generate dataset even if it exists")
+	setupLog := logFlags(flags)
+	flags.Parse(args)
+	setupLog()
+
+	strategyList := strings.Split(*strategies, ",")
+	for _, s := range strategyList {
+		if s != strategyBTree && s != strategyIntervals {
+			usageError(flags, fmt.Errorf("unknown strategy %q", s))
+		}
+	}
+
+	paths := flags.Args()
+	var truth *ip.GeneratorResult
+	if len(paths) == 0 {
+		dataset := path.Join(dataFolder, benchFile)
+		truth = benchDataset(dataset, *regenerate, ip.GeneratorConfig{
+			Seed:         *seed,
+			Distribution: *distribution,
+			Lines:        *lines,
+			Unique:       *lines / 2,
+			Duplication:  2,
+			ZipfS:        1.1,
+			Clusters:     64,
+			ClusterBits:  16,
+		})
+		paths = []string{dataset}
+	}
+
+	configs := benchConfigs([]benchDim{
+		{*readers, func(c *benchConfig, v int) { c.Readers = v }},
+		{*partitions, func(c *benchConfig, v int) { c.Partitions = v }},
+		{*elements, func(c *benchConfig, v int) { c.Elements = v }},
+		{*degrees, func(c *benchConfig, v int) { c.BTreeDegree = v }},
+		{*pageSizes, func(c *benchConfig, v int) { c.PageSize = v }},
+		{*readerCaches, func(c *benchConfig, v int) { c.ReaderCache = v }},
+		{*arrayCaches, func(c *benchConfig, v int) { c.ArrayCache = v }},
+		{*sampleSizes, func(c *benchConfig, v int) { c.SampleSize = v }},
+	}, strategyList)
+
+	results := []*benchResult{}
+	for i, c := range configs {
+		for range *repeat {
+			slog.Info("bench run", "run", len(results) + 1, "of", len(configs) * *repeat, "config", fmt.Sprintf("%+v", c))
+			r := benchRun(c, paths)
+			if truth != nil && r.Unique != truth.Unique {
+				slog.Error("unique count doesn't match ground truth", "config", i, "unique", r.Unique, "expected", truth.Unique)
+				r.Correct = false
+			}
+			results = append(results, r)
+		}
+	}
+
+	// the fastest runs first
+	slices.SortStableFunc(results, func(a, b *benchResult) int {
+		if a.WallSec < b.WallSec {
+			return -1
+		} else if a.WallSec > b.WallSec {
+			return 1
+		}
+		return 0
+	})
+
+	printBenchTable(os.Stdout, results)
+	data := util.Must(json.MarshalIndent(results, "", "  "))
+	util.PanicIfErr(os.WriteFile(*out, append(data, '\n'), 0644))
+	slog.Info("bench results written", "file", *out, "runs", len(results))
+	return 0
+}
+
+// dimension of configuration grid, set assigns its value to configuration
+type benchDim struct {
+	values []int
+	set    func(c *benchConfig, v int)
+}
+
+// returns every combination of values of dimensions and strategies
+func benchConfigs(grid []benchDim, strategies []string) []benchConfig {
+	configs := []benchConfig{{}}
+	for _, dim := range grid {
+		combined := []benchConfig{}
+		for _, c := range configs {
+			for _, v := range dim.values {
+				dim.set(&c, v)
+				combined = append(combined, c)
+			}
+		}
+		configs = combined
+	}
+	combined := []benchConfig{}
+	for _, c := range configs {
+		for _, s := range strategies {
+			c.Strategy = s
+			combined = append(combined, c)
+		}
+	}
+	return combined
+}
+
+// generates dataset unless it exists with ground truth of the same generator
+// configuration and returns ground truth
+func benchDataset(dataset string, regenerate bool, cfg ip.GeneratorConfig) *ip.GeneratorResult {
+	if _, err := os.Stat(dataset + truthSuffix); err == nil && !regenerate {
+		truth := readTruth(dataset + truthSuffix)
+		if truth.Seed == cfg.Seed && truth.Distribution == cfg.Distribution && truth.Lines == cfg.Lines {
+			slog.Info("reusing dataset", "file", dataset, "lines", truth.Lines, "unique", truth.Unique)
+			return truth
+		}
+	}
+
+	slog.Info("generating dataset", "file", dataset, "lines", cfg.Lines, "distribution", cfg.Distribution)
+	f := util.Must(os.OpenFile(dataset, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644))
+	truth := ip.Generate(f, cfg)
+	util.PanicIfErr(f.Close())
+	writeTruth(dataset + truthSuffix, truth)
+	return truth
+}
+
+// runs count in child process, so peak RSS of each run is measured separately
+func benchRun(c benchConfig, paths []string) *benchResult {
+	args := append([]string{"count", "-report", "json", "-progress", "none", "-log-level", "warn"}, c.args()...)
+	cmd := exec.Command(util.Must(os.Executable()), append(args, paths...)...)
+	stdout := &bytes.Buffer{}
+	cmd.Stdout, cmd.Stderr = stdout, os.Stderr
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		panic(fmt.Errorf("bench run %+v failed: %w", c, err))
+	}
+	wall := time.Since(start)
+
+	r := &report{}
+	util.PanicIfErr(json.Unmarshal(stdout.Bytes(), r))
+	return &benchResult{
+		Config:           c,
+		WallSec:          wall.Seconds(),
+		WriteSec:         r.WriteSec,
+		ReadSec:          r.ReadSec,
+		LinesPerSec:      float64(r.Lines) / wall.Seconds(),
+		PeakRSSBytes:     r.PeakRSSBytes,
+		DiskBytesWritten: r.DiskBytesWritten,
+		Unique:           r.Unique,
+		Correct:          true,
+	}
+}
+
+func printBenchTable(w io.Writer, results []*benchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "rank\treaders\tpartitions\telements\tdegree\tpage\treader cache\tarray cache\tsample\tstrategy\twall\tlines/s\tpeak rss\tdisk\t")
+	for i, r := range results {
+		c := r.Config
+		wall := (time.Duration(r.WallSec * float64(time.Second))).Round(time.Millisecond).String()
+		if !r.Correct {
+			wall += " (wrong)"
+		}
+		fmt.Fprintf(
+			tw, "%d\t%d\t%d\t%d\t%d\t%s\t%d\t%d\t%d\t%s\t%s\t%.0f\t%s\t%s\t\n",
+			i + 1, c.Readers, c.Partitions, c.Elements, c.BTreeDegree, progress.Bytes(uint64(c.PageSize)),
+			c.ReaderCache, c.ArrayCache, c.SampleSize, c.Strategy, wall, r.LinesPerSec,
+			progress.Bytes(r.PeakRSSBytes), progress.Bytes(r.DiskBytesWritten),
+		)
+	}
+	util.PanicIfErr(tw.Flush())
+}
+
+// comma separated list of ints
+type intList []int
+
+func (l *intList) String() string {
+	values := []string{}
+	for _, v := range *l {
+		values = append(values, strconv.Itoa(v))
+	}
+	return strings.Join(values, ",")
+}
+
+func (l *intList) Set(s string) error {
+	values := intList{}
+	for _, v := range strings.Split(s, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		values = append(values, n)
+	}
+	*l = values
+	return nil
+}
+
+func intListFlag(flags *flag.FlagSet, name string, value []int, usage string) *[]int {
+	l := intList(value)
+	flags.Var(&l, name, usage)
+	return (*[]int)(&l)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// grid holds every combination of values and strategies once, arguments of
+// each configuration are accepted by count and give the same result
+func TestBenchConfigs(t *testing.T) {
+	configs := benchConfigs([]benchDim{
+		{[]int{1, 4}, func(c *benchConfig, v int) { c.Readers = v }},
+		{[]int{3}, func(c *benchConfig, v int) { c.Partitions = v }},
+		{[]int{500, 1000, 5000}, func(c *benchConfig, v int) { c.Elements = v }},
+		{[]int{4}, func(c *benchConfig, v int) { c.BTreeDegree = v }},
+		{[]int{4096}, func(c *benchConfig, v int) { c.PageSize = v }},
+		{[]int{1024}, func(c *benchConfig, v int) { c.ReaderCache = v }},
+		{[]int{64}, func(c *benchConfig, v int) { c.ArrayCache = v }},
+		{[]int{0, 1024}, func(c *benchConfig, v int) { c.SampleSize = v }},
+	}, []string{strategyBTree, strategyIntervals})
+
+	seen := map[benchConfig]bool{}
+	for _, c := range configs {
+		seen[c] = true
+	}
+	if len(configs) != 24 || len(seen) != 24 {
+		t.Fatalf("%d configurations, %d distinct ones, expected 24", len(configs), len(seen))
+	}
+
+	lines := &strings.Builder{}
+	for i := range 6000 {
+		fmt.Fprintf(lines, "10.0.%d.%d\n", i / 2 >> 8, i / 2 & 0xff)
+	}
+	input := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(input, []byte(lines.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range configs {
+		if c.Readers != 4 || c.Elements != 1000 || c.SampleSize != 1024 {
+			continue
+		}
+		args := append([]string{"-report", "json", "-dst", t.TempDir()}, c.args()...)
+		code, out := runCount(t, append(args, input)...)
+		r := &report{}
+		if err := json.Unmarshal([]byte(out), r); code != 0 || err != nil {
+			t.Fatalf("%+v: exit code %d, json report: %v", c, code, err)
+		}
+		mode := map[string]string{strategyBTree: "ips", strategyIntervals: "intervals"}[c.Strategy]
+		if r.Mode != mode || len(r.Partitions) != 3 || r.Unique != 3000 {
+			t.Errorf("%+v: mode %s, %d partitions, unique %d, expected %s, 3 and 3000", c, r.Mode, len(r.Partitions), r.Unique, mode)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package components
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+	"log/slog"
+
+	"ip_addr_counter/pkg/compress"
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/util"
+)
+
+// size of tar header block, it is enough to detect both tar and zip archives
+const tarBlockSize = 512
+
+func isTar(header []byte) bool {
+	return len(header) >= 262 && string(header[257:262]) == "ustar"
+}
+
+func isZip(header []byte) bool {
+	return bytes.HasPrefix(header, []byte("PK\x03\x04")) || bytes.HasPrefix(header, []byte("PK\x05\x06"))
+}
+
+// returns name of archive member input
+func memberName(archive, member string) string {
+	return archive + ":" + member
+}
+
+// adds regular files of seekable tar archive as seekable inputs
+func (s *inputSet) addTar(name string, r io.ReaderAt, size int64) {
+	sr := io.NewSectionReader(r, 0, size)
+	tr := tar.NewReader(sr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		util.PanicIfErr(err)
+		if !hdr.FileInfo().Mode().IsRegular() {
+			continue
+		}
+
+		// tar reader reads headers without buffering, so member data starts
+		// at current position of underlying reader
+		offset := util.Must(sr.Seek(0, io.SeekCurrent))
+		s.addFile(memberName(name, hdr.Name), io.NewSectionReader(r, offset, hdr.Size), hdr.Size, false)
+	}
+}
+
+// adds tar archive stream (e.g. .tar.gz). Members of such archive can be read
+// only one after another, so they are read by single reader and registered
+// as inputs while reading, unless they are spilled into temporary files
+func (s *inputSet) addTarStream(name string, r io.Reader) {
+	if s.spill {
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			util.PanicIfErr(err)
+			if hdr.FileInfo().Mode().IsRegular() {
+				stream, _ := compress.DecompressStream(tr)
+				s.addSpilled(memberName(name, hdr.Name), stream)
+			}
+		}
+		return
+	}
+
+	s.streams = append(s.streams, func(yield func(ip.Segment) bool) {
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				return
+			}
+			util.PanicIfErr(err)
+			if !hdr.FileInfo().Mode().IsRegular() {
+				continue
+			}
+
+			stream, format := compress.DecompressStream(tr)
+			member := memberName(name, hdr.Name)
+			slog.Info("input", "file", member, "compression", format, "sequential", true)
+			source := s.register(member)
+			if !yield(ip.Segment{Source: source, Reader: stream}) {
+				return
+			}
+		}
+	})
+}
+
+// adds regular files of zip archive. Stored (not compressed) members are added
+// as seekable inputs, compressed ones as streams or spilled into temporary
+// files.
+func (s *inputSet) addZip(name string, r io.ReaderAt, size int64) {
+	zr := util.Must(zip.NewReader(r, size))
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		member := memberName(name, f.Name)
+		if f.Method == zip.Store {
+			offset := util.Must(f.DataOffset())
+			memberSize := int64(f.UncompressedSize64)
+			s.addFile(member, io.NewSectionReader(r, offset, memberSize), memberSize, false)
+		} else if s.spill {
+			rc := util.Must(f.Open())
+			stream, _ := compress.DecompressStream(rc)
+			s.addSpilled(member, stream)
+			util.PanicIfErr(rc.Close())
+		} else {
+			s.addLazyStream(member, f.Open)
+		}
+	}
+}
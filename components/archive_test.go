@@ -0,0 +1,120 @@
+package components
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"maps"
+	"path/filepath"
+	"testing"
+)
+
+// archive member, nil data means directory
+type testMember struct {
+	name   string
+	data   []byte
+	stored bool
+}
+
+func gzipData(data []byte) []byte {
+	b := &bytes.Buffer{}
+	w := gzip.NewWriter(b)
+	w.Write(data)
+	w.Close()
+	return b.Bytes()
+}
+
+func tarData(members ...testMember) []byte {
+	b := &bytes.Buffer{}
+	w := tar.NewWriter(b)
+	for _, m := range members {
+		hdr := &tar.Header{Name: m.name, Mode: 0644, Size: int64(len(m.data)), Typeflag: tar.TypeReg}
+		if m.data == nil {
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		w.WriteHeader(hdr)
+		w.Write(m.data)
+	}
+	w.Close()
+	return b.Bytes()
+}
+
+func zipData(members ...testMember) []byte {
+	b := &bytes.Buffer{}
+	w := zip.NewWriter(b)
+	for _, m := range members {
+		hdr := &zip.FileHeader{Name: m.name, Method: zip.Deflate}
+		if m.stored {
+			hdr.Method = zip.Store
+		}
+		f, _ := w.CreateHeader(hdr)
+		f.Write(m.data)
+	}
+	w.Close()
+	return b.Bytes()
+}
+
+// plain, gzip, tar, tar.gz and zip inputs are counted per input (archive
+// member) and in total, whether they are read in parallel, sequentially or
+// spilled into temporary files
+func TestMixedInputs(t *testing.T) {
+	dir := t.TempDir()
+	plain := writeTestFile(t, dir, "plain.txt", testLines(1 << 24, 4000))
+	gz := writeTestFile(t, dir, "plain.gz", gzipData(testLines(2 << 24, 3000)))
+	tr := writeTestFile(t, dir, "a.tar", tarData(
+		testMember{name: "a.txt", data: testLines(3 << 24, 2000)},
+		testMember{name: "dir/"},
+		// the same ips as the first ones of plain input
+		testMember{name: "dir/b.txt.gz", data: gzipData(testLines(1 << 24, 1000))},
+	))
+	tgz := writeTestFile(t, dir, "b.tar.gz", gzipData(tarData(
+		testMember{name: "c.txt", data: testLines(4 << 24, 1000)},
+	)))
+	zp := writeTestFile(t, dir, "c.zip", zipData(
+		testMember{name: "d.txt", data: testLines(5 << 24, 800), stored: true},
+		// the same ips as the first ones of gzip input
+		testMember{name: "e.txt", data: testLines(2 << 24, 600)},
+	))
+
+	expected := map[string]uint64{
+		plain:                2000,
+		gz:                   1500,
+		tr + ":a.txt":        1000,
+		tr + ":dir/b.txt.gz": 500,
+		tgz + ":c.txt":       500,
+		zp + ":d.txt":        400,
+		zp + ":e.txt":        300,
+	}
+
+	// decompressed gzip file, tar.gz member, gzip tar member and deflated zip
+	// member are copied into temporary files if inputs are spilled
+	spilled := uint64(len(testLines(2 << 24, 3000)) + len(testLines(1 << 24, 1000)) +
+		len(testLines(4 << 24, 1000)) + len(testLines(2 << 24, 600)))
+
+	for _, spill := range []bool{false, true} {
+		for _, readers := range []int{1, 4} {
+			cfg := testConfigs(t, filepath.Join(dir, "*"))
+			cfg.SpillInput, cfg.IPReaderCount = spill, readers
+			read, write := countTest(t, cfg)
+
+			// streams are registered while reading, so order of inputs isn't fixed
+			counts := map[string]uint64{}
+			for i, name := range write.Inputs {
+				counts[name] = read.UniqCountPerInput[i]
+			}
+			if !maps.Equal(counts, expected) {
+				t.Errorf("spill %t, %d readers: unique counts %v, expected %v", spill, readers, counts, expected)
+			}
+			if expected := map[bool]uint64{false: 0, true: spilled}[spill]; write.SpilledBytes != expected {
+				t.Errorf("spill %t, %d readers: %d bytes spilled, expected %d", spill, readers, write.SpilledBytes, expected)
+			}
+			if write.Lines != 12400 || write.Invalid != 0 || read.UniqCount != 5400 {
+				t.Errorf(
+					"spill %t, %d readers: lines %d, invalid %d, unique %d, expected 12400 lines and 5400 unique",
+					spill, readers, write.Lines, write.Invalid, read.UniqCount,
+				)
+			}
+		}
+	}
+}
@@ -0,0 +1,244 @@
+package components
+
+import (
+	"bytes"
+	"io"
+	"slices"
+
+	array "ip_addr_counter/pkg/array/generic"
+	"ip_addr_counter/pkg/compress"
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/util"
+)
+
+// count of ips sampled to estimate partition loads if sampling of partition
+// bounds is disabled
+const explainSampleSize = 64 * 1024
+
+// count and size of reads used to estimate average line length of input
+const explainReads = 16
+const explainReadSize = 64 * 1024
+
+// size of btree node without keys: leaf flag, count, keys and children slices
+const btreeNodeHeaderSize = 64
+
+// execution plan of Write and Read with estimations of their resource usage.
+// Estimations assume that all values are unique, so counts of flushes, runs
+// and disk space are upper bounds.
+type Plan struct {
+	Inputs      []InputPlan     `json:"inputs"`
+	Partitioner *ip.Partitioner `json:"-"`
+	Partitions  []PartitionPlan `json:"partitions"`
+	// count of ips partition loads are estimated from
+	Samples     int             `json:"samples"`
+
+	// estimated count of lines of inputs with known size
+	Lines        uint64 `json:"lines"`
+	// true if count of lines of some inputs (streams, compressed files) is
+	// unknown, so estimations are lower than real values
+	Partial      bool   `json:"partial"`
+	// count of inputs read sequentially. Members of tar streams are not
+	// known until they are read, so they are not listed in Inputs
+	Streams      int    `json:"streams"`
+	// max count of btrees (in-memory runs) of single partition stage, one per input
+	BTrees       int    `json:"btrees_per_stage"`
+	Flushes      int    `json:"flushes"`
+	Runs         int    `json:"runs"`
+	// max count of runs open at the same time, runs are open only while
+	// their partition is merged
+	OpenRuns     int    `json:"open_runs"`
+	// bytes of runs written into DstPath and ExtraDstPaths, and bytes
+	// written into each of them
+	RunBytes     uint64   `json:"run_bytes"`
+	DstBytes     []uint64 `json:"dst_bytes"`
+
+	WriteMemory WriteMemoryPlan `json:"write_memory"`
+	// bytes of read buffers of runs of partitions merged at the same time
+	ReadMemory  uint64          `json:"read_memory"`
+}
+
+type InputPlan struct {
+	Name        string `json:"name"`
+	// size of input, zero for streams
+	Size        int64  `json:"size"`
+	Compression string `json:"compression"`
+	// read by single reader as stream
+	Sequential  bool   `json:"sequential"`
+	// start offsets of segments read in parallel, compressed offsets of
+	// blocks for BGZF input
+	Segments    []int64 `json:"segments"`
+	// estimated count of lines, zero if unknown
+	Lines       uint64 `json:"lines"`
+}
+
+type PartitionPlan struct {
+	// estimated count of values routed into partition
+	Load    uint64 `json:"load"`
+	Flushes int    `json:"flushes"`
+	Runs    int    `json:"runs"`
+}
+
+// peak memory of writing phase, each partition holds values of current stage
+// and values of previous stage being flushed
+type WriteMemoryPlan struct {
+	// btrees (interval slices) of stages
+	Stages  uint64 `json:"stages"`
+	// in-memory arrays values are copied into before writing to file
+	Arrays  uint64 `json:"arrays"`
+	// pages of inputs being read
+	Pages   uint64 `json:"pages"`
+	// batches of parsed values waiting for partitions
+	Batches uint64 `json:"batches"`
+	Total   uint64 `json:"total"`
+}
+
+// computes execution plan of Write (WriteIntervals if intervals is true) and
+// Read for inputs without running them. Inputs are only sampled, nothing is
+// written, so inputs aren't spilled even if SpillInput is set. Streams
+// (stdin, pipes, fifos) are not opened, so they can be read by Write after
+// Explain, and their lines are unknown.
+func Explain(cfg *WrtieConfigs, parallelReaders, arrayCacheSize int, intervals bool) *Plan {
+	in := openInputs(cfg, cfg.DstPath, true)
+	defer in.close()
+
+	maxLineSize, valueSize := ip.MaxIpAddrSize, uint64(ipSize)
+	if intervals {
+		maxLineSize, valueSize = ip.MaxRangeSize, uint64(intervalSize)
+	}
+
+	plan := &Plan{Partitioner: newPartitioner(cfg, in, maxLineSize)}
+
+	// inputs, segments and their lines
+	segmentSize := in.segmentSize(cfg.IPReaderCount)
+	plan.Partial = len(in.streams) > 0
+	plan.Streams = len(in.streams)
+	names := in.inputNames()
+	seekable := map[int]*seekableInput{}
+	for _, input := range in.seekable {
+		seekable[input.source] = input
+	}
+	for source, name := range names {
+		input, ok := seekable[source]
+		if !ok {
+			plan.Inputs = append(plan.Inputs, InputPlan{Name: name, Sequential: true})
+			continue
+		}
+
+		p := InputPlan{
+			Name:        name,
+			Size:        input.size,
+			Compression: input.format.String(),
+			Segments:    input.segmentOffsets(segmentSize, cfg.IPReaderCount, maxLineSize),
+		}
+		if input.format == compress.None {
+			p.Lines = estimateLines(input.file, input.size)
+			plan.Lines += p.Lines
+		} else {
+			plan.Partial = true
+		}
+		plan.Inputs = append(plan.Inputs, p)
+	}
+
+	// loads of partitions are estimated by sampled ips
+	samples, _ := in.sample(max(cfg.PartitionSampleSize, explainSampleSize), maxLineSize)
+	plan.Samples = len(samples)
+	plan.BTrees = len(names)
+	plan.Partitions = make([]PartitionPlan, cfg.PartitionCount)
+	for _, v := range samples {
+		plan.Partitions[plan.Partitioner.Index(v)].Load++
+	}
+
+	elements := uint64(cfg.ElementsPerStage)
+	stageValues := uint64(0)
+	dsts := 1 + len(cfg.ExtraDstPaths)
+	plan.DstBytes = make([]uint64, dsts)
+	for i := range plan.Partitions {
+		p := &plan.Partitions[i]
+		if len(samples) > 0 {
+			p.Load = plan.Lines * p.Load / uint64(len(samples))
+		} else {
+			p.Load = plan.Lines / uint64(cfg.PartitionCount)
+		}
+
+		p.Flushes = int((p.Load + elements - 1) / elements)
+		p.Runs = p.Flushes
+		if !intervals {
+			p.Runs *= len(names)
+		}
+		plan.Flushes += p.Flushes
+		plan.Runs += p.Runs
+		plan.RunBytes += p.Load * valueSize
+		// runs are placed the same way as by stageProcessor
+		for f := range p.Flushes {
+			dst := (i + f) % dsts
+			if cfg.Placement == PlacementPartition {
+				dst = i % dsts
+			}
+			plan.DstBytes[dst] += p.Load * valueSize / uint64(p.Flushes)
+		}
+		stageValues += min(p.Load, elements)
+	}
+
+	// current stage and previous one being flushed
+	mem := &plan.WriteMemory
+	if intervals {
+		mem.Stages = 2 * stageValues * valueSize
+	} else {
+		mem.Stages = 2 * btreeBytes(stageValues, cfg.BTDegree)
+	}
+	mem.Arrays = uint64(cfg.PartitionCount) * elements * valueSize
+	mem.Pages = uint64(cfg.IPReaderCount) * uint64(cfg.IPReaderPageSize)
+	// queued batches of each partition and partially filled batches of readers
+	mem.Batches = uint64(cfg.PartitionCount * (util.BatchCount(cfg.IPReaderCacheSize) + cfg.IPReaderCount) * util.BatchSize) * valueSize
+	mem.Total = mem.Stages + mem.Arrays + mem.Pages + mem.Batches
+
+	// partitions with the most runs merged at the same time
+	runs := []int{}
+	for _, p := range plan.Partitions {
+		runs = append(runs, p.Runs)
+	}
+	slices.Sort(runs)
+	slices.Reverse(runs)
+	for _, n := range runs[:min(parallelReaders, len(runs))] {
+		plan.OpenRuns += n
+		plan.ReadMemory += uint64(n * array.IteratorBufferedValues(arrayCacheSize)) * valueSize
+	}
+
+	return plan
+}
+
+// estimates count of lines of file by count of '\n' in reads evenly spread
+// over file. Lines of small files are counted exactly
+func estimateLines(file io.ReaderAt, size int64) uint64 {
+	if size <= explainReads * explainReadSize {
+		data := make([]byte, size)
+		n, err := file.ReadAt(data, 0)
+		if err != io.EOF {
+			util.PanicIfErr(err)
+		}
+		lines := bytes.Count(data[:n], []byte{'\n'})
+		if n > 0 && data[n - 1] != '\n' {
+			lines++
+		}
+		return uint64(lines)
+	}
+
+	buf := make([]byte, explainReadSize)
+	lines := 0
+	for i := range int64(explainReads) {
+		n, err := file.ReadAt(buf, (size - explainReadSize) * i / (explainReads - 1))
+		if err != io.EOF {
+			util.PanicIfErr(err)
+		}
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+	}
+	return uint64(float64(lines) * float64(size) / float64(explainReads * explainReadSize))
+}
+
+// estimates memory of btrees holding count values. Nodes of btree built by
+// random insertions are about ln(2) full
+func btreeBytes(count uint64, degree int) uint64 {
+	keys := 2 * degree - 1
+	nodes := float64(count) / (0.69 * float64(keys))
+	return uint64(nodes * float64(btreeNodeHeaderSize + keys * ipSize))
+}
@@ -0,0 +1,69 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// returns small configuration of pipeline writing runs into temporary folder,
+// so tests flush several stages and merge several runs per partition
+func testConfigs(t *testing.T, paths ...string) *WrtieConfigs {
+	t.Helper()
+	return &WrtieConfigs{
+		IPFilePaths:         paths,
+		DstPath:             t.TempDir(),
+		Prefix:              "array",
+		IPReaderCount:       4,
+		PartitionCount:      4,
+		ElementsPerStage:    1000,
+		IPReaderPageSize:    4096,
+		IPReaderCacheSize:   1024,
+		BTDegree:            4,
+		PartitionSampleSize: 1024,
+	}
+}
+
+// writes file with given content into dir and returns its path
+func writeTestFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// counts unique ips of inputs of cfg by Write and Read, returns result of
+// Read and statistics of Write
+func countTest(t *testing.T, cfg *WrtieConfigs) (*ReadResult, WriteStats) {
+	t.Helper()
+	write := Write(cfg)
+	read := Read(&ReadConfigs{
+		ArrayListPerStage:        write.Runs,
+		ParallelArrayReaderCount: 2,
+		ArrayIteratorCacheSize:   64,
+		SourceCount:              len(write.Inputs),
+	})
+	write.Remove()
+	return read, write.WriteStats
+}
+
+// replaces standard input by pipe data is written into, until test ends
+func pipeStdin(t *testing.T, data []byte) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		r.Close()
+	})
+	go func() {
+		w.Write(data)
+		w.Close()
+	}()
+}
@@ -0,0 +1,482 @@
+package components
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip_addr_counter/pkg/compress"
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/source"
+	"ip_addr_counter/pkg/util"
+)
+
+// IPFilePaths value meaning ips are read from standard input
+const StdinPath = "-"
+
+// seekable input, which can be sampled and read by segments in parallel
+type seekableInput struct {
+	source int
+	file   io.ReaderAt
+	size   int64
+	// None or BGZF
+	format compress.Format
+}
+
+// set of input files (or archive members) with ips. Seekable inputs are read
+// by segments in parallel, non-seekable streams (stdin, pipes, fifos) and
+// compressed files which can't be split into blocks are read sequentially
+// by single reader unless they are spilled into temporary files.
+type inputSet struct {
+	spill        bool
+	tempDir      string
+	prefix       string
+	// limits writes of spilled inputs
+	writeLimiter *util.RateLimiter
+	// drop inputs from page cache after reading
+	lowPriority  bool
+	// open top level streams only when they are read, so they aren't
+	// consumed by Explain before Write reads them
+	lazyStreams  bool
+
+	m        sync.Mutex
+	// names of inputs, index of name is source of input segments
+	names    []string
+	seekable []*seekableInput
+	// jobs of sequentially read inputs
+	streams  []ip.Job
+
+	// files to close and temporary files to remove after reading
+	closers []io.Closer
+	temp    []string
+	// count of bytes copied into temporary files
+	spilled uint64
+
+	// count of bytes read from inputs and temporary files, updated atomically
+	read    uint64
+	// total size of inputs and temporary files, unknown if some streams are
+	// read without spilling
+	total        uint64
+	totalUnknown bool
+}
+
+// opens inputs of cfg, inputs which can't be read in parallel are spilled
+// into tempDir if cfg.SpillInput is set. If lazyStreams is set, stdin, pipes
+// and fifos are neither opened nor read until their jobs are read, so they
+// can be inspected without losing their data
+func openInputs(cfg *WrtieConfigs, tempDir string, lazyStreams bool) *inputSet {
+	s := &inputSet{
+		spill:        cfg.SpillInput && !lazyStreams,
+		tempDir:      tempDir,
+		prefix:       cfg.Prefix,
+		writeLimiter: cfg.WriteLimiter,
+		lowPriority:  cfg.LowPriority,
+		lazyStreams:  lazyStreams,
+	}
+	for _, p := range expandPaths(cfg.IPFilePaths) {
+		s.open(p)
+	}
+	for _, src := range cfg.IPSources {
+		s.addSource(src)
+	}
+	return s
+}
+
+func isURL(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// matches globs and replaces directories by regular files inside them
+func expandPaths(paths []string) []string {
+	expanded := []string{}
+	for _, p := range paths {
+		if p == StdinPath || isURL(p) {
+			expanded = append(expanded, p)
+			continue
+		}
+
+		matches := []string{p}
+		if strings.ContainsAny(p, "*?[") {
+			matches = util.Must(filepath.Glob(p))
+			if len(matches) == 0 {
+				panic(fmt.Errorf("no files match %q", p))
+			}
+		}
+
+		for _, m := range matches {
+			if !util.Must(os.Stat(m)).IsDir() {
+				expanded = append(expanded, m)
+				continue
+			}
+
+			util.PanicIfErr(filepath.WalkDir(m, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && d.Type().IsRegular() {
+					expanded = append(expanded, path)
+				}
+				return err
+			}))
+		}
+	}
+	return expanded
+}
+
+func (s *inputSet) open(path string) {
+	if path == StdinPath {
+		s.addTopStream(path, func() (io.ReadCloser, error) {
+			return os.Stdin, nil
+		})
+		return
+	}
+
+	if isURL(path) {
+		src, err := source.HTTP(nil, path)
+		if errors.Is(err, source.ErrNotSeekable) {
+			// server ignores Range requests, so file is downloaded by single reader
+			s.addTopStream(path, func() (io.ReadCloser, error) {
+				return source.HTTPStream(nil, path)
+			})
+			return
+		}
+		s.addSource(util.Must(src, err))
+		return
+	}
+
+	src, err := source.File(path)
+	if errors.Is(err, source.ErrNotSeekable) {
+		// pipes, fifos and other special files are read as streams
+		s.addTopStream(path, func() (io.ReadCloser, error) {
+			return os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+		})
+		return
+	}
+	if err == nil && s.lowPriority {
+		util.PanicIfErr(util.AdviseSequential(src.File))
+	}
+	s.addSource(util.Must(src, err))
+}
+
+// adds source with random access, it is closed after reading
+func (s *inputSet) addSource(src source.Interface) {
+	s.closers = append(s.closers, src)
+	s.total += uint64(src.Size())
+	s.addFile(src.Name(), &countingReaderAt{src, &s.read}, src.Size(), true)
+}
+
+// adds input stream given by path. Size of stream is unknown until it is read,
+// so with spilling it is added to total after copying, and total becomes
+// unknown otherwise. Streams of URLs and all streams if lazyStreams is set are
+// opened only when they are read, tar archives in them aren't detected
+func (s *inputSet) addTopStream(name string, open func() (io.ReadCloser, error)) {
+	n := uint64(0)
+	counted := func() (io.ReadCloser, error) {
+		rc, err := open()
+		if err != nil {
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{&countingReader{rc, &n, &s.read}, rc}, nil
+	}
+
+	if !s.spill {
+		s.totalUnknown = true
+		if isURL(name) || s.lazyStreams {
+			s.addLazyStream(name, counted)
+			return
+		}
+	}
+
+	rc := util.Must(counted())
+	s.closers = append(s.closers, rc)
+	s.addStream(name, rc, true)
+	s.total += n
+}
+
+// adds seekable file. Archives are replaced by their members if allowArchive
+func (s *inputSet) addFile(name string, r io.ReaderAt, size int64, allowArchive bool) {
+	header := make([]byte, tarBlockSize)
+	n, err := r.ReadAt(header, 0)
+	if err != io.EOF {
+		util.PanicIfErr(err)
+	}
+	header = header[:n]
+
+	if allowArchive && isZip(header) {
+		s.addZip(name, r, size)
+		return
+	} else if allowArchive && isTar(header) {
+		s.addTar(name, r, size)
+		return
+	}
+
+	format := compress.Detect(header)
+	if format != compress.None && format != compress.BGZF {
+		s.addStream(name, io.NewSectionReader(r, 0, size), allowArchive)
+		return
+	}
+
+	slog.Info("input", "file", name, "compression", format, "sequential", false)
+	s.seekable = append(s.seekable, &seekableInput{
+		source: s.register(name),
+		file:   r,
+		size:   size,
+		format: format,
+	})
+}
+
+// adds stream, which can be read only once. Stream is decompressed if needed.
+// Tar archives are replaced by their members if allowArchive
+func (s *inputSet) addStream(name string, r io.Reader, allowArchive bool) {
+	stream, format := compress.DecompressStream(r)
+	if allowArchive {
+		br := bufio.NewReaderSize(stream, tarBlockSize)
+		header, err := br.Peek(tarBlockSize)
+		if err != io.EOF {
+			util.PanicIfErr(err)
+		}
+		stream = br
+
+		if isTar(header) {
+			s.addTarStream(name, br)
+			return
+		}
+	}
+
+	if s.spill {
+		s.addSpilled(name, stream)
+		return
+	}
+
+	slog.Info("input", "file", name, "compression", format, "sequential", true)
+	s.streams = append(s.streams, ip.SingleJob(ip.Segment{Source: s.register(name), Reader: stream}))
+}
+
+// same as addStream, but stream is opened only when it is going to be read.
+// Spilled streams are added by addSpilled instead
+func (s *inputSet) addLazyStream(name string, open func() (io.ReadCloser, error)) {
+	slog.Info("input", "file", name, "sequential", true)
+	source := s.register(name)
+	s.streams = append(s.streams, func(yield func(ip.Segment) bool) {
+		rc, err := open()
+		if err != nil {
+			// error is returned by the first read of segment, so it is
+			// reported by reader like other read errors
+			yield(ip.Segment{Source: source, Reader: errReader{fmt.Errorf("open %s: %w", name, err)}})
+			return
+		}
+		defer rc.Close()
+		stream, _ := compress.DecompressStream(rc)
+		yield(ip.Segment{Source: source, Reader: stream})
+	})
+}
+
+// reader failing with err
+type errReader struct {
+	err error
+}
+
+func (er errReader) Read([]byte) (int, error) {
+	return 0, er.err
+}
+
+// copies stream into temporary file and adds it as seekable input
+func (s *inputSet) addSpilled(name string, stream io.Reader) {
+	f, err := os.CreateTemp(s.tempDir, s.prefix + "_input_*")
+	util.PanicIfErr(writeError(err, s.tempDir))
+	s.closers = append(s.closers, f)
+	s.temp = append(s.temp, f.Name())
+
+	n, err := io.Copy(f, util.RateLimitedReader(stream, s.writeLimiter))
+	util.PanicIfErr(writeError(err, f.Name()))
+	s.spilled += uint64(n)
+	s.total += uint64(n)
+	slog.Info("input spilled", "file", name, "bytes", n, "temp_file", f.Name())
+	s.addFile(name, &countingReaderAt{f, &s.read}, n, false)
+}
+
+// registers input name and returns its source index. Members of tar streams
+// are registered while reading, so it must be safe for concurrent use
+func (s *inputSet) register(name string) int {
+	s.m.Lock()
+	defer s.m.Unlock()
+	s.names = append(s.names, name)
+	return len(s.names) - 1
+}
+
+// returns names of inputs indexed by source
+func (s *inputSet) inputNames() []string {
+	s.m.Lock()
+	defer s.m.Unlock()
+	return append([]string{}, s.names...)
+}
+
+// returns read jobs. Seekable inputs are split into line aligned segments of
+// roughly total size / readers bytes, so readers are distributed between all
+// inputs. Streams are returned first, since they can't be split.
+func (s *inputSet) jobs(readers, maxLineSize int) []ip.Job {
+	segmentSize := s.segmentSize(readers)
+
+	jobs := append([]ip.Job{}, s.streams...)
+	for _, in := range s.seekable {
+		offsets := in.segmentOffsets(segmentSize, readers, maxLineSize)
+
+		var segments []io.Reader
+		if in.format == compress.None {
+			for i, from := range offsets {
+				to := in.size
+				if i != len(offsets) - 1 {
+					to = offsets[i + 1]
+				}
+				segments = append(segments, io.NewSectionReader(in.file, from, to - from))
+			}
+		} else {
+			segments = ip.BlockSegments(offsets, in.size, func(from, to int64) io.Reader {
+				return compress.NewReader(in.format, io.NewSectionReader(in.file, from, to - from))
+			})
+		}
+
+		for _, segment := range segments {
+			jobs = append(jobs, ip.SingleJob(ip.Segment{Source: in.source, Reader: segment}))
+		}
+	}
+	return jobs
+}
+
+// returns size of segments of seekable inputs read by readers
+func (s *inputSet) segmentSize(readers int) int64 {
+	total := int64(0)
+	for _, in := range s.seekable {
+		total += in.size
+	}
+	return max(1, total / int64(readers))
+}
+
+// returns start offsets of segments of roughly segmentSize bytes, at most
+// readers segments. Offsets are line aligned for uncompressed input and block
+// aligned for BGZF one.
+func (in *seekableInput) segmentOffsets(segmentSize int64, readers, maxLineSize int) []int64 {
+	count := int(min(max(1, (in.size + segmentSize - 1) / segmentSize), int64(readers)))
+	if in.format == compress.None {
+		return ip.SegmentOffsets(in.file, in.size, count, maxLineSize)
+	}
+	return compress.BlockOffsets(in.file, in.size, count)
+}
+
+// samples uncompressed seekable inputs, count of samples from each input is
+// proportional to its size. Returns false if there are no such inputs.
+func (s *inputSet) sample(sampleSize, maxLineSize int) ([]uint32, bool) {
+	total := int64(0)
+	for _, in := range s.seekable {
+		if in.format == compress.None {
+			total += in.size
+		}
+	}
+	if total == 0 {
+		return nil, false
+	}
+
+	// bytes read while sampling are not part of progress
+	read := atomic.LoadUint64(&s.read)
+	defer atomic.StoreUint64(&s.read, read)
+
+	samples := []uint32{}
+	for _, in := range s.seekable {
+		if in.format == compress.None {
+			count := int(int64(sampleSize) * in.size / total)
+			samples = append(samples, ip.Sample(in.file, in.size, count, maxLineSize)...)
+		}
+	}
+	return samples, true
+}
+
+// checks if some inputs can't be sampled
+func (s *inputSet) partiallySampleable() bool {
+	if len(s.streams) > 0 {
+		return true
+	}
+	for _, in := range s.seekable {
+		if in.format != compress.None {
+			return true
+		}
+	}
+	return false
+}
+
+// returns statistics of writing phase started at start
+func (s *inputSet) writeStats(
+	run *runDir,
+	stats *ip.Stats,
+	partitioner *ip.Partitioner,
+	partitions []PartitionWriteStats,
+	start time.Time,
+) WriteStats {
+	return WriteStats{
+		Inputs:       s.inputNames(),
+		Lines:        stats.Lines,
+		Invalid:      stats.Invalid,
+		SpilledBytes: s.spilled,
+		RunID:        run.info.ID,
+		Dir:          run.dir,
+		run:          run,
+		Partitioner:  partitioner,
+		Partitions:   partitions,
+		Duration:     time.Since(start),
+	}
+}
+
+// returns count of bytes read from inputs and their total size, zero if
+// it is unknown
+func (s *inputSet) progress() (read, total uint64) {
+	if s.totalUnknown {
+		return atomic.LoadUint64(&s.read), 0
+	}
+	return atomic.LoadUint64(&s.read), s.total
+}
+
+func (s *inputSet) close() {
+	for _, c := range s.closers {
+		if f, ok := c.(*source.FileSource); ok && s.lowPriority {
+			util.PanicIfErr(util.DropCache(f.File))
+		}
+		util.PanicIfErr(c.Close())
+	}
+	for _, name := range s.temp {
+		util.PanicIfErr(os.Remove(name))
+	}
+}
+
+// counts bytes read from underlying reader
+type countingReaderAt struct {
+	r io.ReaderAt
+	n *uint64
+}
+
+func (cr *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := cr.r.ReadAt(p, off)
+	atomic.AddUint64(cr.n, uint64(n))
+	return n, err
+}
+
+// counts bytes read from stream into own counter and total counter
+type countingReader struct {
+	r     io.Reader
+	n     *uint64
+	total *uint64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	atomic.AddUint64(cr.n, uint64(n))
+	atomic.AddUint64(cr.total, uint64(n))
+	return n, err
+}
@@ -0,0 +1,133 @@
+package components
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"ip_addr_counter/pkg/source"
+)
+
+// returns count lines of ips starting at first, every ip is repeated twice
+func testLines(first, count int) []byte {
+	data := &bytes.Buffer{}
+	for i := range count {
+		ip := first + i / 2
+		fmt.Fprintf(data, "%d.%d.%d.%d\n", ip >> 24, ip >> 16 & 0xff, ip >> 8 & 0xff, ip & 0xff)
+	}
+	return data.Bytes()
+}
+
+// urls are read by Range requests, by single GET if server doesn't support
+// them, in-memory sources are read like files
+func TestHTTPAndBytesInputs(t *testing.T) {
+	ranges := testLines(10 << 24, 4000)
+	plain := testLines(20 << 24, 3000)
+	noHead := testLines(10 << 24, 2000)
+	mem := testLines(30 << 24, 1000)
+
+	rangeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "ips.txt", time.Time{}, bytes.NewReader(ranges))
+	}))
+	defer rangeServer.Close()
+	plainServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(plain)
+	}))
+	defer plainServer.Close()
+	noHeadServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		w.Write(noHead)
+	}))
+	defer noHeadServer.Close()
+
+	cfg := testConfigs(t, rangeServer.URL, plainServer.URL, noHeadServer.URL)
+	cfg.IPSources = []source.Interface{source.Bytes("memory", mem)}
+	read, write := countTest(t, cfg)
+
+	names := []string{rangeServer.URL, plainServer.URL, noHeadServer.URL, "memory"}
+	if !slices.Equal(write.Inputs, names) {
+		t.Fatalf("inputs %q, expected %q", write.Inputs, names)
+	}
+	if write.Lines != 10000 || write.Invalid != 0 {
+		t.Errorf("lines %d, invalid %d, expected 10000 lines without invalid ones", write.Lines, write.Invalid)
+	}
+	// ips of noHead input are the same as first ips of ranges input
+	if expected := []uint64{2000, 1500, 1000, 500}; !slices.Equal(read.UniqCountPerInput, expected) || read.UniqCount != 4000 {
+		t.Errorf("unique counts %v, total %d, expected %v and 4000", read.UniqCountPerInput, read.UniqCount, expected)
+	}
+}
+
+// stdin is read by single reader, which dispatches lines into partitions,
+// or copied into temporary file and read by segments if it is spilled
+func TestStdinInput(t *testing.T) {
+	data := testLines(1 << 24, 6000)
+	for _, spill := range []bool{false, true} {
+		pipeStdin(t, data)
+		cfg := testConfigs(t, StdinPath)
+		cfg.SpillInput = spill
+		read, write := countTest(t, cfg)
+
+		if expected := map[bool]uint64{false: 0, true: uint64(len(data))}[spill]; write.SpilledBytes != expected {
+			t.Errorf("spill %t: %d bytes spilled, expected %d", spill, write.SpilledBytes, expected)
+		}
+		if write.Lines != 6000 || write.Invalid != 0 || read.UniqCount != 3000 {
+			t.Errorf(
+				"spill %t: lines %d, invalid %d, unique %d, expected 6000 lines and 3000 unique",
+				spill, write.Lines, write.Invalid, read.UniqCount,
+			)
+		}
+		if !slices.Equal(write.Inputs, []string{StdinPath}) {
+			t.Errorf("spill %t: inputs %q, expected stdin only", spill, write.Inputs)
+		}
+		// spilled stdin is sampled, so ips are spread between partitions
+		if spill && write.Partitions[0].Load == write.Lines {
+			t.Errorf("spilled stdin: all ips are routed into the first partition")
+		}
+	}
+}
+
+// url answered with error status fails Write before reading, folder of run
+// is removed
+func TestHTTPInputNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	cfg := testConfigs(t, server.URL + "/missing.txt")
+
+	func() {
+		defer func() {
+			if err, ok := recover().(error); !ok || !strings.Contains(err.Error(), "404") {
+				t.Errorf("Write failed with %v, expected 404 error", err)
+			}
+		}()
+		Write(cfg)
+	}()
+	if entries, _ := os.ReadDir(cfg.DstPath); len(entries) != 0 {
+		t.Errorf("destination holds %v after failed Write", entries)
+	}
+}
+
+// error of opening lazy stream is returned by read of its segment
+func TestLazyStreamOpenError(t *testing.T) {
+	s := &inputSet{}
+	s.addLazyStream("missing", func() (io.ReadCloser, error) {
+		return nil, errors.New("not found")
+	})
+
+	for segment := range s.streams[0] {
+		_, err := segment.Read(make([]byte, 16))
+		if err == nil || err.Error() != "open missing: not found" {
+			t.Errorf("read error %v, expected open error", err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package components
+
+import (
+	"sync/atomic"
+
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/metrics"
+	"ip_addr_counter/pkg/util"
+)
+
+// phases exposed by phase metric
+var phases = []string{"write", "read", "done"}
+
+// upper bounds of buckets of flush durations in seconds
+var flushBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60}
+
+// metrics of counting, updated by Write, stageProcessor and Read
+type Metrics struct {
+	// counts of lines of running Write
+	stats        atomic.Pointer[ip.Stats]
+	inserts      *metrics.CounterVec
+	flushes      *metrics.CounterVec
+	flushedBytes *metrics.CounterVec
+	merged       *metrics.CounterVec
+	flushSeconds *metrics.Histogram
+	openFiles    *metrics.Gauge
+	phase        *metrics.GaugeVec
+}
+
+// creates metrics and registers them in registry. Nil registry means
+// metrics are updated, but not exposed
+func NewMetrics(r *metrics.Registry) *Metrics {
+	m := &Metrics{
+		inserts:      r.CounterVec("ip_counter_btree_inserts_total", "Values inserted into in-memory btrees (interval slices).", "partition"),
+		flushes:      r.CounterVec("ip_counter_flushes_total", "Sorted runs flushed into on-disk arrays.", "partition"),
+		flushedBytes: r.CounterVec("ip_counter_flushed_bytes_total", "Bytes of flushed on-disk arrays.", "partition"),
+		merged:       r.CounterVec("ip_counter_merged_values_total", "Values read from on-disk arrays while merging.", "partition"),
+		flushSeconds: r.Histogram("ip_counter_flush_duration_seconds", "Durations of flushing runs into on-disk arrays.", flushBuckets),
+		openFiles:    r.Gauge("ip_counter_open_files", "On-disk array files currently open."),
+		phase:        r.GaugeVec("ip_counter_phase", "Current phase, 1 for running one.", "phase"),
+	}
+
+	r.CounterFunc("ip_counter_lines_total", "Lines read from inputs.", func() uint64 {
+		if stats := m.stats.Load(); stats != nil {
+			return atomic.LoadUint64(&stats.Lines)
+		}
+		return 0
+	})
+	r.CounterFunc("ip_counter_parse_errors_total", "Invalid lines skipped while reading inputs.", func() uint64 {
+		if stats := m.stats.Load(); stats != nil {
+			return atomic.LoadUint64(&stats.Invalid)
+		}
+		return 0
+	})
+	return m
+}
+
+// sets running phase, one of "write", "read" or "done"
+func (m *Metrics) SetPhase(phase string) {
+	for _, p := range phases {
+		if p == phase {
+			m.phase.With(p).Set(1)
+		} else {
+			m.phase.With(p).Set(0)
+		}
+	}
+}
+
+// returns m or not exposed metrics if m is nil
+func metricsOrNop(m *Metrics) *Metrics {
+	if m == nil {
+		return NewMetrics(nil)
+	}
+	return m
+}
+
+// counter of single goroutine added to shared counter every util.BatchSize
+// values, so hot loops don't update shared counter for each value. flush
+// must be called when counting is finished
+type localCounter struct {
+	c       *metrics.Counter
+	pending uint64
+}
+
+func (lc *localCounter) inc() {
+	lc.pending++
+	if lc.pending == util.BatchSize {
+		lc.flush()
+	}
+}
+
+func (lc *localCounter) flush() {
+	lc.c.Add(lc.pending)
+	lc.pending = 0
+}
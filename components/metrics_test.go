@@ -0,0 +1,25 @@
+package components
+
+import (
+	"testing"
+
+	"ip_addr_counter/pkg/metrics"
+)
+
+// inserts counted locally by partitions are published completely
+func TestInsertsMetric(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "ips.txt", testLines(0, 50_000))
+	cfg := testConfigs(t, path)
+	cfg.Metrics = NewMetrics(metrics.NewRegistry())
+	write := Write(cfg)
+	defer write.Remove()
+
+	for i, p := range write.Partitions {
+		if inserts := cfg.Metrics.inserts.WithInt(i).Value(); inserts != p.Load {
+			t.Errorf("partition %d: %d inserts, expected %d", i, inserts, p.Load)
+		}
+	}
+	if write.Lines != 50_000 {
+		t.Errorf("%d lines, expected 50000", write.Lines)
+	}
+}
@@ -0,0 +1,67 @@
+package components
+
+import (
+	"log/slog"
+	"math"
+
+	"ip_addr_counter/pkg/ip"
+)
+
+// returns partitioner for inputs. If sampling is enabled, partition bounds
+// are computed from quantiles of sampled ips, otherwise ip space is split
+// into equal ranges.
+func newPartitioner(cfg *WrtieConfigs, in *inputSet, maxLineSize int) *ip.Partitioner {
+	count := cfg.PartitionCount
+	if cfg.PartitionSampleSize == 0 {
+		return ip.UniformPartitioner(count)
+	}
+
+	// Explain doesn't spill inputs, but Write samples them after spilling, so
+	// there is nothing to warn about
+	warn := !cfg.SpillInput || in.spill
+	samples, ok := in.sample(cfg.PartitionSampleSize, maxLineSize)
+	if !ok {
+		if warn {
+			slog.Warn("inputs are not seekable or compressed, partition bounds can't be sampled without spilling")
+		}
+		return ip.UniformPartitioner(count)
+	} else if warn && in.partiallySampleable() {
+		slog.Warn("some inputs are not seekable or compressed, partition bounds are sampled from the rest")
+	}
+
+	partitioner := ip.QuantilePartitioner(samples, count)
+
+	slog.Info("partition bounds sampled", "samples", len(samples))
+	for i := range count {
+		slog.Debug("partition bounds", "partition", i, "range", RangeString(partitioner, i))
+	}
+	return partitioner
+}
+
+// logs count of values routed into each partition
+func logPartitionLoads(partitioner *ip.Partitioner, partitions []PartitionWriteStats) {
+	total := uint64(0)
+	for _, p := range partitions {
+		total += p.Load
+	}
+
+	for i, p := range partitions {
+		slog.Info(
+			"partition load",
+			"partition", i,
+			"range", RangeString(partitioner, i),
+			"load", p.Load,
+			"percent", math.Round(10000 * float64(p.Load) / float64(max(total, 1))) / 100,
+			"runs", p.Runs,
+		)
+	}
+}
+
+// returns range of i'th partition as "from - to" string
+func RangeString(partitioner *ip.Partitioner, i int) string {
+	if partitioner.Empty(i) {
+		return "empty"
+	}
+	from, to := partitioner.Range(i)
+	return ip.ToString(uint32(from)) + " - " + ip.ToString(uint32(to))
+}
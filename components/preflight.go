@@ -0,0 +1,102 @@
+package components
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"syscall"
+
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// count of files open besides runs and inputs: standard streams, metrics
+// server, profiles, descriptors of go runtime
+const reservedFiles = 32
+
+// creates destination folders if they don't exist and checks that they are
+// writable. If plan isn't nil, also checks that estimated runs fit into free
+// space of devices of destination folders and runs of partitions merged at
+// the same time fit into open files limit. Estimations of plan are upper
+// bounds, so these checks may fail for inputs with many duplicates.
+func Preflight(cfg *WrtieConfigs, plan *Plan) []error {
+	dsts := append([]string{cfg.DstPath}, cfg.ExtraDstPaths...)
+	for _, dst := range dsts {
+		if err := os.MkdirAll(dst, 0755); err != nil {
+			return []error{fmt.Errorf("destination folder can't be created: %w", err)}
+		}
+		f, err := os.CreateTemp(dst, cfg.Prefix + "_preflight_*")
+		if err != nil {
+			return []error{fmt.Errorf("destination folder isn't writable: %w", err)}
+		}
+		util.PanicIfErr(f.Close())
+		util.PanicIfErr(os.Remove(f.Name()))
+	}
+
+	if plan == nil {
+		return nil
+	}
+
+	// folders on the same device share its free space
+	required := map[uint64]uint64{}
+	paths := map[uint64]string{}
+	devices := []uint64{}
+	for i, dst := range dsts {
+		dev, err := util.DeviceID(dst)
+		if err != nil {
+			// folders are treated as placed on different devices
+			dev = uint64(i)
+		}
+		if _, ok := paths[dev]; !ok {
+			paths[dev] = dst
+			devices = append(devices, dev)
+		}
+		required[dev] += plan.DstBytes[i]
+	}
+
+	errs := []error{}
+	for _, dev := range devices {
+		dst := paths[dev]
+		if free, err := util.FreeSpace(dst); err != nil {
+			slog.Warn("free disk space is unknown", "path", dst, "err", err)
+		} else {
+			slog.Info("disk space", "path", dst, "free", free, "required", required[dev])
+			if required[dev] > free {
+				errs = append(errs, fmt.Errorf(
+					"runs may take up to %s, but only %s is free in %s",
+					progress.Bytes(required[dev]), progress.Bytes(free), dst,
+				))
+			}
+		}
+	}
+
+	if limit, err := util.OpenFilesLimit(); err != nil {
+		slog.Warn("open files limit is unknown", "err", err)
+	} else {
+		files := uint64(plan.OpenRuns + len(plan.Inputs) + reservedFiles)
+		slog.Info("open files", "limit", limit, "required", files)
+		if files > limit {
+			errs = append(errs, fmt.Errorf(
+				"up to %d files may be open (%d runs), but limit is %d, raise it by ulimit -n, increase -elements or decrease -array-readers",
+				files, plan.OpenRuns, limit,
+			))
+		}
+	}
+
+	if plan.Partial && len(errs) == 0 {
+		slog.Warn("sizes of some inputs are unknown, disk space and open files may be insufficient")
+	}
+	return errs
+}
+
+// replaces errors of creating and writing files in destination folder by
+// readable ones if disk is full or there are too many open files
+func writeError(err error, path string) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("no space left on device while writing %s, free disk space or reduce input: %w", path, err)
+	} else if errors.Is(err, syscall.EMFILE) {
+		return fmt.Errorf("too many open files while creating %s, raise limit by ulimit -n, increase -elements or decrease -array-readers: %w", path, err)
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package components
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// preflight estimates plan before Write, stdin must be left unread for Write
+func TestStdinAfterPreflight(t *testing.T) {
+	lines := 20_000
+	data := &strings.Builder{}
+	for i := range lines {
+		fmt.Fprintf(data, "10.%d.%d.%d\n", i >> 16, (i >> 8) & 0xff, i & 0xff)
+	}
+
+	pipeStdin(t, []byte(data.String()))
+
+	cfg := testConfigs(t, StdinPath)
+	plan := Explain(cfg, 2, 64, false)
+	if !plan.Partial || plan.Streams != 1 {
+		t.Errorf("plan of stdin: partial %v, streams %d, expected partial plan with 1 stream", plan.Partial, plan.Streams)
+	}
+	if errs := Preflight(cfg, plan); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+
+	read, write := countTest(t, cfg)
+	if write.Lines != uint64(lines) || write.Invalid != 0 {
+		t.Errorf("lines %d, invalid %d, expected %d lines without invalid ones", write.Lines, write.Invalid, lines)
+	}
+	if read.UniqCount != uint64(lines) {
+		t.Errorf("unique count %d, expected %d", read.UniqCount, lines)
+	}
+}
+
+// compressed input can't be sampled by Explain, but it is sampled by Write
+// after spilling, so preflight warns only if spilling is disabled
+func TestSampleWarningWithSpill(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.txt", testLines(1 << 24, 1000))
+	writeTestFile(t, dir, "b.gz", gzipData(testLines(2 << 24, 1000)))
+
+	logs := &bytes.Buffer{}
+	logger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(logs, &slog.HandlerOptions{Level: slog.LevelWarn})))
+	defer slog.SetDefault(logger)
+
+	for _, spill := range []bool{false, true} {
+		logs.Reset()
+		cfg := testConfigs(t, filepath.Join(dir, "*"))
+		cfg.SpillInput = spill
+		Explain(cfg, 2, 64, false)
+		if warned := strings.Contains(logs.String(), "partition bounds are sampled from the rest"); warned == spill {
+			t.Errorf("spill %t: warned %t about inputs which can't be sampled, logs:\n%s", spill, warned, logs)
+		}
+
+		// spilled input is sampled by Write
+		logs.Reset()
+		Write(cfg).Remove()
+		if warned := strings.Contains(logs.String(), "sampled"); warned == spill {
+			t.Errorf("spill %t: write warned %t about inputs which can't be sampled, logs:\n%s", spill, warned, logs)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package components
+
+import (
+	"sync/atomic"
+	"time"
+
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// count of values merged by partition reader between progress counter updates
+const progressBatchSize = 64 * 1024
+
+// reports snapshots every interval until returned stop is called. stop
+// reports final snapshot of phase. Nil reporter means progress.Nop and zero
+// interval means one second.
+func reportProgress(
+	reporter progress.Reporter,
+	interval time.Duration,
+	snapshot func(elapsed time.Duration) progress.Snapshot,
+) (stop func()) {
+	if reporter == nil {
+		reporter = progress.Nop()
+	}
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	start := time.Now()
+	stopInterval := util.SetInterval(func(start, now time.Time) {
+		reporter.Report(snapshot(now.Sub(start)))
+	}, interval)
+
+	return func() {
+		stopInterval()
+		s := snapshot(time.Since(start))
+		s.Done = true
+		reporter.Report(s)
+	}
+}
+
+// returns snapshot of merge of runs with elements of elemSize bytes. counts
+// are updated atomically by partition readers
+func mergeSnapshot(
+	elapsed time.Duration,
+	readCounts, uniqCounts []uint64,
+	totalCount uint64,
+	elemSize int,
+) progress.Snapshot {
+	s := progress.Snapshot{Phase: "read", Elapsed: elapsed, TotalBytes: totalCount * uint64(elemSize)}
+	for i := range readCounts {
+		s.Count += atomic.LoadUint64(&readCounts[i])
+		s.Unique += atomic.LoadUint64(&uniqCounts[i])
+	}
+	s.Bytes = s.Count * uint64(elemSize)
+	return s
+}
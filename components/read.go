@@ -1,82 +1,234 @@
 package components
 
 import (
-	"fmt"
+	"context"
 	"iter"
+	"log/slog"
 	"math"
+	"path"
+	"runtime/trace"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"ip_addr_counter/pkg/file"
+	"ip_addr_counter/pkg/progress"
 	"ip_addr_counter/pkg/util"
 )
 
-func Read(cfg *ReadConfigs) uint64 {
+// merges runs of each partition and returns count of unique ips across all
+// inputs, count of unique ips of each input (indexed by Run.Source) and
+// statistics of each partition
+func Read(cfg *ReadConfigs) *ReadResult {
+	start := time.Now()
+	m := metricsOrNop(cfg.Metrics)
+	m.SetPhase("read")
+	ctx, task := trace.NewTask(context.Background(), "read")
+	defer task.End()
+
 	// count of read ip addresses from array files
 	readCountPerSegment := make([]uint64, len(cfg.ArrayListPerStage))
 
 	// count of unique ip addresses
-	uniqCount := uint64(0)
+	totalUniqCount := uint64(0)
 	uniqCountPerSegment := make([]uint64, len(cfg.ArrayListPerStage))
 
-	// printing progress each second
-	stop := util.SetInterval(func(start, now time.Time) {
-		sec := now.Sub(start).Seconds()
-		readCount := uint64(0)
-		uniqCount := uint64(0)
-		for i := range len(cfg.ArrayListPerStage) {
-			readCount += readCountPerSegment[i]
-			uniqCount += uniqCountPerSegment[i]
+	// count of unique ip addresses of each input
+	uniqCountPerSource := make([]uint64, cfg.SourceCount)
+
+	// total count of values in arrays
+	totalCount := uint64(0)
+	for _, arrList := range cfg.ArrayListPerStage {
+		for _, arr := range arrList {
+			totalCount += arr.Len()
 		}
+	}
 
-		fmt.Printf(
-			"readCount %d, uniqCount %d, sec %d, eps %d\n",
-			readCount, uniqCount, uint64(sec), readCount / uint64(sec),
-		)
-	}, time.Second)
-	defer stop()
+	// reporting progress of merging arrays
+	stop := reportProgress(cfg.Progress, cfg.ProgressInterval, func(elapsed time.Duration) progress.Snapshot {
+		return mergeSnapshot(elapsed, readCountPerSegment, uniqCountPerSegment, totalCount, ipSize)
+	})
 
 	// this two nested cycles are needed to distribute load on disk.
 	// Actually just limits simultaneously running goroutines to parallelArrayReaderCount
 	// It creates no more than parallelArrayReaderCount goroutines each of which
-	// reads array lists created by index'th segment
+	// reads array lists of index'th partition
+	order := mergeOrder(cfg.ArrayListPerStage)
 	for i := range int(math.Ceil(float64(len(cfg.ArrayListPerStage)) / float64(cfg.ParallelArrayReaderCount))) {
 		wg := &sync.WaitGroup{}
 
 		for j := range cfg.ParallelArrayReaderCount {
-			index := i * cfg.ParallelArrayReaderCount + j
-			if index == len(cfg.ArrayListPerStage) {
+			k := i * cfg.ParallelArrayReaderCount + j
+			if k == len(order) {
 				break
 			}
+			index := order[k]
 
-			last := IP(math.MaxUint32)
 			arrList := cfg.ArrayListPerStage[index]
-			iterators := make([]iter.Seq[IP], len(arrList))
+			iterators := make([]iter.Seq[sourcedIP], len(arrList))
 			for i := range arrList {
-				iterators[i] = arrList[i].Iterator(cfg.ArrayIteratorCacheSize)
+				iterators[i] = arrList[i].sourcedIterator(cfg.ArrayIteratorCacheSize, cfg.ReadLimiter)
 			}
 
+			// files of runs are open only while partition is merged
+			m.openFiles.Add(int64(len(arrList)))
 			wg.Add(1)
 			go func () {
 				defer wg.Done()
-				// reading values from list of iterators by increasing order
-				for ip := range util.MultiIterator(iterators) {
-					readCountPerSegment[index]++
+				defer trace.StartRegion(ctx, "merge").End()
+				defer func() {
+					for _, arr := range arrList {
+						util.PanicIfErr(arr.Close())
+					}
+					m.openFiles.Add(-int64(len(arrList)))
+				}()
+				trace.Logf(ctx, "merge", "partition %d runs %d", index, len(arrList))
+				var last sourcedIP
+				first := true
+				uniqPerSource := make([]uint64, cfg.SourceCount)
+
+				// counters are published periodically for progress reporting
+				readCount, uniqCount := uint64(0), uint64(0)
+				merged, published := m.merged.WithInt(index), uint64(0)
+				publish := func() {
+					merged.Add(readCount - published)
+					published = readCount
+					atomic.StoreUint64(&readCountPerSegment[index], readCount)
+					atomic.StoreUint64(&uniqCountPerSegment[index], uniqCount)
+				}
+
+				// reading values from list of iterators by increasing order of
+				// ip and then source
+				for v := range util.MultiIterator(iterators) {
+					readCount++
 					// since ips are being read in increasing order
 					// uniqCount must be incremented only when previous ip
-					// is not equal to current ip
-					if last != ip {
-						last = ip
-						uniqCountPerSegment[index]++
+					// is not equal to current ip. Same for ips of each source
+					if first || last.ip() != v.ip() {
+						uniqCount++
+					}
+					if first || last != v {
+						uniqPerSource[v.source()]++
+					}
+					last, first = v, false
+
+					if readCount % progressBatchSize == 0 {
+						publish()
 					}
 				}
 
-				atomic.AddUint64(&uniqCount, uniqCountPerSegment[index])
+				publish()
+				atomic.AddUint64(&totalUniqCount, uniqCount)
+				for source, count := range uniqPerSource {
+					atomic.AddUint64(&uniqCountPerSource[source], count)
+				}
 			}()
 		}
 
 		wg.Wait()
 	}
 
-	return uniqCount
-}
\ No newline at end of file
+	stop()
+	return &ReadResult{
+		UniqCount:         totalUniqCount,
+		UniqCountPerInput: uniqCountPerSource,
+		ReadStats:         readStats(readCountPerSegment, uniqCountPerSegment, start),
+	}
+}
+
+// returns order of merging partitions. Partitions are grouped by device
+// holding most values of their runs and groups are interleaved, so
+// partitions merged at the same time read different devices. Order isn't
+// changed if all runs are on single device
+func mergeOrder[A interface {
+	File() file.Interface
+	Len() uint64
+}](partitions [][]A) []int {
+	// devices of run folders
+	devices := map[string]uint64{}
+	return orderByDevice(partitions, func(run A) uint64 {
+		of, ok := run.File().(*file.OSFile)
+		if !ok {
+			return 0
+		}
+		dir := path.Dir(of.Path())
+		if _, ok := devices[dir]; !ok {
+			// device is unknown on some platforms, runs are treated as
+			// placed on single device
+			devices[dir], _ = util.DeviceID(dir)
+		}
+		return devices[dir]
+	})
+}
+
+// interleaves partitions grouped by device returned by device for runs, see
+// mergeOrder. Groups are ordered by their first partitions
+func orderByDevice[A interface{ Len() uint64 }](partitions [][]A, device func(run A) uint64) []int {
+	groups := map[uint64][]int{}
+	keys := []uint64{}
+	for i, runs := range partitions {
+		values := map[uint64]uint64{}
+		for _, run := range runs {
+			values[device(run)] += run.Len()
+		}
+
+		primary, primaryValues := uint64(0), uint64(0)
+		for dev, v := range values {
+			if v > primaryValues || v == primaryValues && dev < primary {
+				primary, primaryValues = dev, v
+			}
+		}
+		if _, ok := groups[primary]; !ok {
+			keys = append(keys, primary)
+		}
+		groups[primary] = append(groups[primary], i)
+	}
+
+	order := make([]int, 0, len(partitions))
+	for len(order) < len(partitions) {
+		for _, dev := range keys {
+			if len(groups[dev]) > 0 {
+				order = append(order, groups[dev][0])
+				groups[dev] = groups[dev][1:]
+			}
+		}
+	}
+	if len(keys) > 1 {
+		slog.Debug("merge order", "devices", len(keys), "partitions", order)
+	}
+	return order
+}
+
+// ip tagged with index of its input. Implements util.Comparable interface,
+// values are ordered by ip and then by source
+type sourcedIP uint64
+
+func (v sourcedIP) ip() IP {
+	return IP(v >> 32)
+}
+
+func (v sourcedIP) source() int {
+	return int(uint32(v))
+}
+
+func (v sourcedIP) Compare(v2 util.Comparable) int {
+	v2Casted := v2.(sourcedIP)
+	if v < v2Casted {
+		return -1
+	} else if v > v2Casted {
+		return 1
+	}
+	return 0
+}
+
+// returns iterator of run ips tagged with run source
+func (r *Run) sourcedIterator(cacheSize int, limiter *util.RateLimiter) iter.Seq[sourcedIP] {
+	tag := sourcedIP(r.Source)
+	return func(yield func(sourcedIP) bool) {
+		for ip := range r.Iterator(cacheSize, limiter) {
+			if !yield(sourcedIP(ip) << 32 | tag) {
+				return
+			}
+		}
+	}
+}
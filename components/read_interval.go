@@ -0,0 +1,126 @@
+package components
+
+import (
+	"context"
+	"iter"
+	"math"
+	"runtime/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// same as Read, but merges on-disk arrays of intervals. Overlapping intervals
+// are unioned while reading, so returned value is exact count of ips covered
+// by all intervals.
+func ReadIntervals(cfg *ReadIntervalConfigs) *ReadIntervalResult {
+	start := time.Now()
+	m := metricsOrNop(cfg.Metrics)
+	m.SetPhase("read")
+	ctx, task := trace.NewTask(context.Background(), "read")
+	defer task.End()
+
+	// count of read intervals from array files
+	readCountPerSegment := make([]uint64, len(cfg.ArrayListPerStage))
+
+	// count of covered ip addresses
+	uniqCount := uint64(0)
+	uniqCountPerSegment := make([]uint64, len(cfg.ArrayListPerStage))
+
+	// total count of values in arrays
+	totalCount := uint64(0)
+	for _, arrList := range cfg.ArrayListPerStage {
+		for _, arr := range arrList {
+			totalCount += arr.Len()
+		}
+	}
+
+	// reporting progress of merging arrays
+	stop := reportProgress(cfg.Progress, cfg.ProgressInterval, func(elapsed time.Duration) progress.Snapshot {
+		return mergeSnapshot(elapsed, readCountPerSegment, uniqCountPerSegment, totalCount, intervalSize)
+	})
+
+	// same scheduling as in Read, no more than ParallelArrayReaderCount
+	// goroutines are running simultaneously
+	order := mergeOrder(cfg.ArrayListPerStage)
+	for i := range int(math.Ceil(float64(len(cfg.ArrayListPerStage)) / float64(cfg.ParallelArrayReaderCount))) {
+		wg := &sync.WaitGroup{}
+
+		for j := range cfg.ParallelArrayReaderCount {
+			k := i * cfg.ParallelArrayReaderCount + j
+			if k == len(order) {
+				break
+			}
+			index := order[k]
+
+			arrList := cfg.ArrayListPerStage[index]
+			iterators := make([]iter.Seq[Interval], len(arrList))
+			for i := range arrList {
+				iterators[i] = arrList[i].Iterator(cfg.ArrayIteratorCacheSize, cfg.ReadLimiter)
+			}
+
+			// files of runs are open only while partition is merged
+			m.openFiles.Add(int64(len(arrList)))
+			wg.Add(1)
+			go func () {
+				defer wg.Done()
+				defer trace.StartRegion(ctx, "merge").End()
+				defer func() {
+					for _, arr := range arrList {
+						util.PanicIfErr(arr.Close())
+					}
+					m.openFiles.Add(-int64(len(arrList)))
+				}()
+				trace.Logf(ctx, "merge", "partition %d runs %d", index, len(arrList))
+				var current *Interval
+
+				// counters are published periodically for progress reporting
+				readCount, coveredCount := uint64(0), uint64(0)
+				merged, published := m.merged.WithInt(index), uint64(0)
+				publish := func() {
+					merged.Add(readCount - published)
+					published = readCount
+					atomic.StoreUint64(&readCountPerSegment[index], readCount)
+					atomic.StoreUint64(&uniqCountPerSegment[index], coveredCount)
+				}
+
+				// reading intervals ordered by start. Since starts are increasing,
+				// interval either overlaps with current one or current one
+				// will never be extended anymore
+				for in := range util.MultiIterator(iterators) {
+					readCount++
+					if readCount % progressBatchSize == 0 {
+						publish()
+					}
+
+					if current != nil && in.Start <= current.End {
+						current.End = max(current.End, in.End)
+						continue
+					}
+
+					if current != nil {
+						coveredCount += current.Len()
+					}
+					current = &in
+				}
+
+				if current != nil {
+					coveredCount += current.Len()
+				}
+				publish()
+				atomic.AddUint64(&uniqCount, coveredCount)
+			}()
+		}
+
+		wg.Wait()
+	}
+
+	stop()
+	return &ReadIntervalResult{
+		CoveredCount: uniqCount,
+		ReadStats:    readStats(readCountPerSegment, uniqCountPerSegment, start),
+	}
+}
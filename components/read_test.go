@@ -0,0 +1,63 @@
+package components
+
+import (
+	"slices"
+	"testing"
+)
+
+// run of test partition placed on device
+type testRun struct {
+	device uint64
+	len    uint64
+}
+
+func (r testRun) Len() uint64 {
+	return r.len
+}
+
+// partitions merged one after another read different devices
+func TestOrderByDevice(t *testing.T) {
+	tests := []struct {
+		name       string
+		partitions [][]testRun
+		order      []int
+	}{
+		{
+			"single device",
+			[][]testRun{{{1, 10}}, {{1, 10}, {1, 5}}, {{1, 7}}},
+			[]int{0, 1, 2},
+		},
+		{
+			"partition placement on two devices",
+			[][]testRun{{{1, 10}}, {{1, 10}}, {{2, 10}}, {{2, 10}}},
+			[]int{0, 2, 1, 3},
+		},
+		{
+			"round robin placement, primary device holds most values",
+			[][]testRun{{{1, 10}, {2, 5}}, {{1, 3}, {2, 5}}, {{1, 8}, {2, 1}}, {{1, 1}, {2, 9}}},
+			[]int{0, 1, 2, 3},
+		},
+		{
+			"unequal groups",
+			[][]testRun{{{1, 10}}, {{1, 10}}, {{1, 10}}, {{2, 10}}, {{3, 10}}, {{3, 10}}},
+			[]int{0, 3, 4, 1, 5, 2},
+		},
+		{
+			"tie is broken by smaller device",
+			[][]testRun{{{2, 5}, {1, 5}}, {{2, 5}}, {{1, 5}}},
+			[]int{0, 1, 2},
+		},
+		{
+			"partitions without runs",
+			[][]testRun{{}, {{2, 5}}, {}, {{2, 5}}},
+			[]int{0, 1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		order := orderByDevice(tt.partitions, func(r testRun) uint64 { return r.device })
+		if !slices.Equal(order, tt.order) {
+			t.Errorf("%s: order %v, expected %v", tt.name, order, tt.order)
+		}
+	}
+}
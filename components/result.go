@@ -0,0 +1,119 @@
+package components
+
+import (
+	"time"
+
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/util"
+)
+
+// statistics of writing phase
+type WriteStats struct {
+	// names of inputs indexed by source
+	Inputs       []string
+	// count of read lines including invalid ones
+	Lines        uint64
+	// count of skipped invalid lines
+	Invalid      uint64
+	// bytes of inputs copied into temporary files (see WrtieConfigs.SpillInput)
+	SpilledBytes uint64
+	// id of run and its folder inside DstPath holding runs and spilled
+	// inputs. Folder is locked until Keep or Remove is called
+	RunID        string
+	Dir          string
+	run          *runDir
+	Partitioner  *ip.Partitioner
+	Partitions   []PartitionWriteStats
+	Duration     time.Duration
+}
+
+type PartitionWriteStats struct {
+	// count of values routed into partition
+	Load     uint64
+	// count and total size of flushed on-disk arrays
+	Runs     int
+	RunBytes uint64
+}
+
+// returns count of bytes written into DstPath
+func (ws *WriteStats) WrittenBytes() uint64 {
+	written := ws.SpilledBytes
+	for _, p := range ws.Partitions {
+		written += p.RunBytes
+	}
+	return written
+}
+
+type WriteResult struct {
+	// on-disk arrays of each partition
+	Runs [][]*Run
+	WriteStats
+}
+
+type WriteIntervalResult struct {
+	// on-disk arrays of each partition
+	Runs [][]*IntervalArray
+	WriteStats
+}
+
+// marks run as finished and releases lock of its folder, files of runs are
+// kept until they are garbage collected (see RemoveRun)
+func (ws *WriteStats) Keep() {
+	ws.run.keep()
+}
+
+// deletes files of runs and their folder
+func (wr *WriteResult) Remove() {
+	for _, runs := range wr.Runs {
+		for _, run := range runs {
+			util.PanicIfErr(run.Remove())
+		}
+	}
+	wr.run.remove()
+}
+
+// deletes files of runs and their folder
+func (wr *WriteIntervalResult) Remove() {
+	for _, runs := range wr.Runs {
+		for _, run := range runs {
+			util.PanicIfErr(run.Remove())
+		}
+	}
+	wr.run.remove()
+}
+
+// statistics of reading phase
+type ReadStats struct {
+	Partitions []PartitionReadStats
+	Duration   time.Duration
+}
+
+type PartitionReadStats struct {
+	// count of values read from on-disk arrays of partition
+	Read   uint64
+	// count of unique ips (or covered addresses) of partition
+	Unique uint64
+}
+
+type ReadResult struct {
+	// count of unique ips across all inputs
+	UniqCount         uint64
+	// count of unique ips of each input, indexed by source
+	UniqCountPerInput []uint64
+	ReadStats
+}
+
+type ReadIntervalResult struct {
+	// count of addresses covered by intervals of all inputs
+	CoveredCount uint64
+	ReadStats
+}
+
+// returns statistics of reading phase started at start
+func readStats(readCounts, uniqCounts []uint64, start time.Time) ReadStats {
+	partitions := make([]PartitionReadStats, len(readCounts))
+	for i := range partitions {
+		partitions[i] = PartitionReadStats{Read: readCounts[i], Unique: uniqCounts[i]}
+	}
+	return ReadStats{Partitions: partitions, Duration: time.Since(start)}
+}
@@ -0,0 +1,284 @@
+package components
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"ip_addr_counter/pkg/util"
+)
+
+// files inside folder of each run, see WriteStats.Dir
+const runLockFile = "lock"
+const runInfoFile = "run.json"
+
+// prefix of hidden folder run is prepared in before it is renamed into
+// folder of run, so run is never visible unlocked
+const runTempPrefix = "."
+
+// statuses of runs found in DstPath
+const (
+	// lock of run is held by running process
+	RunActive    = "active"
+	// run finished and its runs were kept
+	RunFinished  = "finished"
+	// run failed or was killed, its lock isn't held anymore
+	RunAbandoned = "abandoned"
+)
+
+// metadata of run written into its folder
+type RunInfo struct {
+	ID       string     `json:"id"`
+	PID      int        `json:"pid"`
+	Host     string     `json:"host"`
+	Inputs   []string   `json:"inputs"`
+	// folders of run in ExtraDstPaths
+	Dirs     []string   `json:"dirs,omitempty"`
+	Started  time.Time  `json:"started"`
+	// nil until run is finished
+	Finished *time.Time `json:"finished,omitempty"`
+}
+
+// folder of single Write inside DstPath. Folder is locked while it is used,
+// so concurrent runs never write into the same files and folders of running
+// processes aren't garbage collected
+type runDir struct {
+	dir  string
+	// folders runs are placed into, dir and folders in ExtraDstPaths
+	dirs []string
+	info *RunInfo
+	lock *util.FileLock
+}
+
+// returns new run id, ids are ordered by start time
+func newRunID() string {
+	suffix := make([]byte, 4)
+	util.Must(rand.Read(suffix))
+	return time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
+
+// creates folder of run in destination folder
+func mkRunDir(dstPath, id string) string {
+	util.PanicIfErr(writeError(os.MkdirAll(dstPath, 0755), dstPath))
+	dir := path.Join(dstPath, id)
+	if err := os.Mkdir(dir, 0755); errors.Is(err, fs.ErrExist) {
+		panic(fmt.Errorf("folder of run %s already exists in %s", id, dstPath))
+	} else {
+		util.PanicIfErr(writeError(err, dir))
+	}
+	return dir
+}
+
+// creates and locks folder for runs and spilled inputs of single Write and
+// folders for runs in ExtraDstPaths. Folder is locked and its metadata is
+// written in hidden folder, which is then renamed, so runs gc never sees
+// folder of starting run unlocked
+func newRunDir(cfg *WrtieConfigs) *runDir {
+	id := cfg.RunID
+	if id == "" {
+		id = newRunID()
+	}
+	dir := path.Join(cfg.DstPath, id)
+	if _, err := os.Lstat(dir); err == nil {
+		panic(fmt.Errorf("folder of run %s already exists in %s", id, cfg.DstPath))
+	}
+	tmp := mkRunDir(cfg.DstPath, runTempPrefix + id)
+	// lock is held on opened file, so it stays locked after renaming
+	lock := util.Must(util.TryLock(path.Join(tmp, runLockFile)))
+
+	host, _ := os.Hostname()
+	rd := &runDir{tmp, nil, &RunInfo{
+		ID:      id,
+		PID:     os.Getpid(),
+		Host:    host,
+		Inputs:  cfg.IPFilePaths,
+		Started: time.Now(),
+	}, lock}
+	for _, dstPath := range cfg.ExtraDstPaths {
+		extra := mkRunDir(dstPath, id)
+		rd.dirs = append(rd.dirs, extra)
+		rd.info.Dirs = append(rd.info.Dirs, extra)
+	}
+	rd.writeInfo()
+	util.PanicIfErr(writeError(os.Rename(tmp, dir), dir))
+	rd.dir = dir
+	rd.dirs = append([]string{dir}, rd.dirs...)
+	slog.Info("run started", "id", id, "dirs", rd.dirs)
+	return rd
+}
+
+func (rd *runDir) writeInfo() {
+	data := util.Must(json.MarshalIndent(rd.info, "", "  "))
+	name := path.Join(rd.dir, runInfoFile)
+	util.PanicIfErr(writeError(os.WriteFile(name, append(data, '\n'), 0644), name))
+}
+
+// marks run as finished and releases its lock, files are kept
+func (rd *runDir) keep() {
+	now := time.Now()
+	rd.info.Finished = &now
+	rd.writeInfo()
+	util.PanicIfErr(rd.lock.Unlock())
+}
+
+// opens inputs of run, spilled inputs are written into folder of run.
+// Folders of run are removed if inputs can't be opened (e.g. url isn't
+// found), since nothing was counted in them
+func (rd *runDir) openInputs(cfg *WrtieConfigs) *inputSet {
+	opened := false
+	defer func() {
+		if !opened {
+			rd.remove()
+		}
+	}()
+	in := openInputs(cfg, rd.dir, false)
+	opened = true
+	return in
+}
+
+// releases lock of run and deletes its folders
+func (rd *runDir) remove() {
+	util.PanicIfErr(rd.lock.Unlock())
+	for _, dir := range rd.dirs {
+		util.PanicIfErr(os.RemoveAll(dir))
+	}
+}
+
+// run folder found in DstPath
+type RunStatus struct {
+	RunInfo
+	Dir    string `json:"dir"`
+	Status string `json:"status"`
+	// count and total size of files of run, including metadata
+	Files  int    `json:"files"`
+	Bytes  uint64 `json:"bytes"`
+}
+
+// returns true if dir is folder of run, i.e. holds its metadata or lock file.
+// Other folders are never inspected or removed
+func isRunDir(dir string) bool {
+	for _, name := range []string{runInfoFile, runLockFile} {
+		if stat, err := os.Stat(path.Join(dir, name)); err == nil && stat.Mode().IsRegular() {
+			return true
+		}
+	}
+	return false
+}
+
+// returns runs found in dstPath ordered by start time. Only folders of runs
+// (see isRunDir) are listed, other folders are skipped. Folder of run killed
+// before writing its metadata is listed with its modification time as start
+// time
+func ListRuns(dstPath string) []*RunStatus {
+	entries, err := os.ReadDir(dstPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	util.PanicIfErr(err)
+
+	runs := []*RunStatus{}
+	for _, e := range entries {
+		// hidden folders are runs which are being started
+		name := e.Name()
+		if e.IsDir() && !strings.HasPrefix(name, runTempPrefix) && isRunDir(path.Join(dstPath, name)) {
+			runs = append(runs, InspectRun(dstPath, name))
+		}
+	}
+	slices.SortFunc(runs, func(a, b *RunStatus) int {
+		return a.Started.Compare(b.Started)
+	})
+	return runs
+}
+
+// returns status of run with given id in dstPath
+func InspectRun(dstPath, id string) *RunStatus {
+	dir := path.Join(dstPath, id)
+	stat := util.Must(os.Stat(dir))
+	if !stat.IsDir() || !isRunDir(dir) {
+		panic(fmt.Errorf("%s is not a folder of run", dir))
+	}
+	rs := &RunStatus{RunInfo: RunInfo{ID: id, Started: stat.ModTime()}, Dir: dir}
+	if data, err := os.ReadFile(path.Join(dir, runInfoFile)); err == nil {
+		util.PanicIfErr(json.Unmarshal(data, &rs.RunInfo))
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		panic(err)
+	}
+
+	for _, dir := range append([]string{dir}, rs.Dirs...) {
+		err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rs.Files++
+			rs.Bytes += uint64(util.Must(d.Info()).Size())
+			return nil
+		})
+		// extra folder may be removed or its disk may be unmounted
+		if errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("folder of run not found", "id", id, "dir", dir)
+			continue
+		}
+		util.PanicIfErr(err)
+	}
+
+	switch {
+	case rs.locked():
+		rs.Status = RunActive
+	case rs.Finished != nil:
+		rs.Status = RunFinished
+	default:
+		rs.Status = RunAbandoned
+	}
+	return rs
+}
+
+// returns true if lock of run is held by running process
+func (rs *RunStatus) locked() bool {
+	name := path.Join(rs.Dir, runLockFile)
+	if _, err := os.Stat(name); err != nil {
+		return false
+	}
+	lock, err := util.TryLock(name)
+	if errors.Is(err, util.ErrLocked) {
+		return true
+	}
+	util.PanicIfErr(err)
+	util.PanicIfErr(lock.Unlock())
+	return false
+}
+
+// deletes folders of run unless run is active or folder isn't folder of run
+// (see isRunDir). Lock is held while folders are deleted, so run can't be
+// started in them at the same time
+func RemoveRun(rs *RunStatus) error {
+	if !isRunDir(rs.Dir) {
+		return fmt.Errorf("%s is not a folder of run", rs.Dir)
+	}
+	name := path.Join(rs.Dir, runLockFile)
+	lock, err := util.TryLock(name)
+	if errors.Is(err, util.ErrLocked) {
+		return fmt.Errorf("run %s is active", rs.ID)
+	} else if err != nil {
+		return err
+	}
+	defer lock.Unlock()
+
+	// main folder is the last, so metadata of run is kept if extra folder
+	// can't be removed
+	for _, dir := range append(slices.Clone(rs.Dirs), rs.Dir) {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
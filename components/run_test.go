@@ -0,0 +1,81 @@
+package components
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// only folders with metadata or lock of run are listed and removed, other
+// folders of destination are never touched
+func TestRunsSkipForeignFolders(t *testing.T) {
+	dst := t.TempDir()
+	foreign := filepath.Join(dst, "my_important_dir")
+	if err := os.Mkdir(foreign, 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, foreign, "data.txt", []byte("keep me"))
+	old := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(foreign, old, old)
+
+	cfg := testConfigs(t)
+	cfg.DstPath = dst
+	kept := newRunDir(cfg)
+	kept.keep()
+	active := newRunDir(cfg)
+	defer active.remove()
+
+	ids := []string{}
+	for _, rs := range ListRuns(dst) {
+		ids = append(ids, rs.ID)
+	}
+	if expected := []string{kept.info.ID, active.info.ID}; !slices.Equal(ids, expected) {
+		t.Fatalf("runs %v, expected %v", ids, expected)
+	}
+
+	if err := RemoveRun(&RunStatus{RunInfo: RunInfo{ID: "my_important_dir"}, Dir: foreign}); err == nil {
+		t.Error("foreign folder is removed")
+	}
+	entries, _ := os.ReadDir(foreign)
+	if len(entries) != 1 || entries[0].Name() != "data.txt" {
+		t.Errorf("foreign folder is changed: %v", entries)
+	}
+
+	for _, rs := range ListRuns(dst) {
+		err := RemoveRun(rs)
+		if rs.ID == active.info.ID {
+			if err == nil || rs.Status != RunActive {
+				t.Errorf("active run is removed or has status %s", rs.Status)
+			}
+		} else if err != nil || rs.Status != RunFinished {
+			t.Errorf("finished run isn't removed: %v, status %s", err, rs.Status)
+		}
+	}
+	if _, err := os.Stat(kept.dir); !os.IsNotExist(err) {
+		t.Errorf("folder of finished run isn't removed: %v", err)
+	}
+}
+
+// folder of run becomes visible locked and with metadata, folder of starting
+// run is hidden
+func TestRunDirLockedWhenVisible(t *testing.T) {
+	dst := t.TempDir()
+	cfg := testConfigs(t)
+	cfg.DstPath, cfg.ExtraDstPaths = dst, []string{t.TempDir()}
+	rd := newRunDir(cfg)
+	defer rd.remove()
+
+	entries, _ := os.ReadDir(dst)
+	if len(entries) != 1 || entries[0].Name() != rd.info.ID {
+		t.Fatalf("destination holds %v, expected only folder of run %s", entries, rd.info.ID)
+	}
+	rs := InspectRun(dst, rd.info.ID)
+	if rs.Status != RunActive || len(rs.Dirs) != 1 {
+		t.Errorf("run has status %s and extra folders %v", rs.Status, rs.Dirs)
+	}
+	if !slices.Equal(rd.dirs, []string{rd.dir, rd.info.Dirs[0]}) {
+		t.Errorf("folders of run %v", rd.dirs)
+	}
+}
@@ -1,32 +1,52 @@
 package components
 
 import (
+	"context"
 	"fmt"
+	"iter"
 	"os"
 	"path"
+	"runtime/trace"
 	"sync"
+	"time"
 
 	array "ip_addr_counter/pkg/array/generic"
 	"ip_addr_counter/pkg/file"
 	"ip_addr_counter/pkg/util"
 )
 
-// returns helper function for converting btree into array
-func stageProcessor(
-	dstPath string,
-	prefix string,
+// placements of runs between destination folders
+const (
+	// runs of each partition are spread between all folders, so merging of
+	// every partition reads all disks
+	PlacementRoundRobin = "round-robin"
+	// all runs of partition are placed into the same folder, partitions are
+	// distributed between folders
+	PlacementPartition  = "partition"
+)
+
+// returns helper function for converting sorted sequence (btree, sorted
+// intervals) into on-disk array in one of dirs chosen by cfg.Placement. done
+// is called with created array, calls are serialized.
+func stageProcessor[T any](
+	cfg *WrtieConfigs,
+	dirs []string,
 	i int,
 	arrVirtualFileSize uint64,
-	arrList *[]*Array,
-) func(t *BTree) *sync.WaitGroup {
+	metrics *Metrics,
+) func(items iter.Seq[T], count uint64, done func(arr *array.Array[T])) *sync.WaitGroup {
 	m := &sync.Mutex{}
+	// count of created arrays
+	n := 0
+	flushes := metrics.flushes.WithInt(i)
+	flushedBytes := metrics.flushedBytes.WithInt(i)
 	arrayVFPool := &sync.Pool{New: func() any {
 		vf := file.Virtual()
 		vf.Truncate(arrVirtualFileSize)
 		return vf
 	}}
 
-	return func(t *BTree) *sync.WaitGroup {
+	return func(items iter.Seq[T], count uint64, done func(arr *array.Array[T])) *sync.WaitGroup {
 		// wait if previous call didn't finished yet
 		m.Lock()
 
@@ -35,32 +55,54 @@ func stageProcessor(
 		go func () {
 			defer wg.Done()
 			defer m.Unlock()
+			// errors of writing into destination folder, e.g. full disk
+			defer util.ExitOnPanic()
+			ctx := context.Background()
+			defer trace.StartRegion(ctx, "flush").End()
+			start := time.Now()
+			trace.Logf(ctx, "flush", "partition %d run %d values %d", i, n, count)
 
-			// initializing in-memory array to copy btree keys in increasing order
-			arr := array.New[IP](arrayVFPool.Get().(*file.VirtualFile), 0)
+			// initializing in-memory array to copy items in increasing order
+			arr := array.New[T](arrayVFPool.Get().(*file.VirtualFile), 0)
 
 			// creating file for array
-			f := util.Must(os.OpenFile(
-				path.Join(dstPath, fmt.Sprintf("%s_%d_%d", prefix, i, len(*arrList))),
-				os.O_RDWR|os.O_CREATE|os.O_TRUNC,
-				os.ModePerm,
-			))
+			dir := dirs[(i + n) % len(dirs)]
+			if cfg.Placement == PlacementPartition {
+				dir = dirs[i % len(dirs)]
+			}
+			name := path.Join(dir, fmt.Sprintf("%s_%d_%d", cfg.Prefix, i, n))
+			f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+			util.PanicIfErr(writeError(err, name))
+			metrics.openFiles.Add(1)
 
-			// scanning btree and pushing to array
-			for k := range t.Iterator() {
+			// scanning items and pushing to array
+			for k := range items {
 				arr.Push(&k)
 			}
 
 			// copying array in-memory data to file
-			f.ReadFrom(arr.FileReader())
+			written, err := f.ReadFrom(util.RateLimitedReader(arr.FileReader(), cfg.WriteLimiter))
+			util.PanicIfErr(writeError(err, name))
 
 			// returning array virtual file to pool for reuse
 			arrayVFPool.Put(arr.File().(*file.VirtualFile))
 
-			util.PanicIfErr(f.Sync())
-			*arrList = append(*arrList, array.New[IP](
-				file.OS(f),
-				t.Count(),
+			// closing file, so runs don't hold file descriptors until they
+			// are merged. Array reopens file when it is read
+			util.PanicIfErr(writeError(f.Sync(), name))
+			if cfg.LowPriority {
+				// run is read again only while merging
+				util.PanicIfErr(util.DropCache(f))
+			}
+			util.PanicIfErr(f.Close())
+			metrics.openFiles.Add(-1)
+			n++
+			flushes.Inc()
+			flushedBytes.Add(uint64(written))
+			metrics.flushSeconds.Observe(time.Since(start).Seconds())
+			done(array.New[T](
+				file.OSPath(name),
+				count,
 			))
 		}()
 
@@ -0,0 +1,116 @@
+package components
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip_addr_counter/pkg/file"
+)
+
+// runs are spread across destination folders: round robin rotates folder of
+// each next run of partition, partition placement keeps runs of partition in
+// single folder
+func TestPlacement(t *testing.T) {
+	for _, placement := range []string{PlacementRoundRobin, PlacementPartition} {
+		// ips spread over whole ip space
+		data := []byte{}
+		for i := range uint32(40_000) {
+			ip := i * 2654435761
+			data = fmt.Appendf(data, "%d.%d.%d.%d\n", ip >> 24, ip >> 16 & 0xff, ip >> 8 & 0xff, ip & 0xff)
+		}
+		path := writeTestFile(t, t.TempDir(), "ips.txt", data)
+		cfg := testConfigs(t, path)
+		cfg.ExtraDstPaths, cfg.Placement = []string{t.TempDir(), t.TempDir()}, placement
+		cfg.PartitionSampleSize = 0
+		write := Write(cfg)
+
+		dirs := write.run.dirs
+		perDir := map[string]int{}
+		for i, runs := range write.Runs {
+			if len(runs) < 3 {
+				t.Fatalf("%s: partition %d has %d runs, expected several", placement, i, len(runs))
+			}
+			for n, run := range runs {
+				dir := filepath.Dir(run.File().(*file.OSFile).Path())
+				perDir[dir]++
+
+				expected := dirs[(i + n) % len(dirs)]
+				if placement == PlacementPartition {
+					expected = dirs[i % len(dirs)]
+				}
+				if dir != expected {
+					t.Errorf("%s: run %d of partition %d is in %s, expected %s", placement, n, i, dir, expected)
+				}
+			}
+		}
+		if len(perDir) != len(dirs) {
+			t.Errorf("%s: runs are placed into %d of %d folders", placement, len(perDir), len(dirs))
+		}
+		write.Remove()
+	}
+}
+
+// returns count of open files of process inside dir, -1 if it is unknown
+func openFilesIn(dir string) int {
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	count := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && strings.HasPrefix(target, dir + "/") {
+			count++
+		}
+	}
+	return count
+}
+
+// files of runs are closed after flushing and after merging, only lock of
+// run folder stays open. Remove deletes runs and folder, Keep leaves them in
+// destination folder
+func TestRunFilesLifecycle(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "ips.txt", testLines(1 << 24, 20_000))
+	for _, keep := range []bool{false, true} {
+		cfg := testConfigs(t, path)
+		write := Write(cfg)
+		runs := 0
+		for _, list := range write.Runs {
+			runs += len(list)
+		}
+		if runs < 8 {
+			t.Fatalf("%d runs, expected several per partition", runs)
+		}
+		if open := openFilesIn(cfg.DstPath); open > 1 {
+			t.Errorf("%d files open in %s after Write, expected lock only", open, cfg.DstPath)
+		}
+
+		Read(&ReadConfigs{
+			ArrayListPerStage:        write.Runs,
+			ParallelArrayReaderCount: 2,
+			ArrayIteratorCacheSize:   64,
+			SourceCount:              len(write.Inputs),
+		})
+		if open := openFilesIn(cfg.DstPath); open > 1 {
+			t.Errorf("%d files open in %s after Read, expected lock only", open, cfg.DstPath)
+		}
+
+		if keep {
+			write.Keep()
+			files, _ := filepath.Glob(filepath.Join(write.Dir, cfg.Prefix + "*"))
+			if len(files) != runs {
+				t.Errorf("kept %d files of runs, expected %d", len(files), runs)
+			}
+			if err := RemoveRun(InspectRun(cfg.DstPath, write.RunID)); err != nil {
+				t.Fatal(err)
+			}
+		} else {
+			write.Remove()
+		}
+		if entries, _ := os.ReadDir(cfg.DstPath); len(entries) != 0 {
+			t.Errorf("keep %t: %v left in destination folder", keep, entries)
+		}
+	}
+}
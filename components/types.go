@@ -1,36 +1,116 @@
 package components
 
 import (
+	"time"
 	"unsafe"
 
 	array "ip_addr_counter/pkg/array/generic"
 	"ip_addr_counter/pkg/btree"
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/source"
 	"ip_addr_counter/pkg/util"
 )
 
 const ipSize = int(unsafe.Sizeof(IP(0)))
+const intervalSize = int(unsafe.Sizeof(Interval{}))
 
 type WrtieConfigs struct {
-	IPFilePath        string
+	// paths of ip files, globs, directories or http(s) urls. Tar and zip
+	// archives are replaced by their members. StdinPath means standard input
+	IPFilePaths       []string
+	// inputs in addition to IPFilePaths, e.g. in-memory data
+	IPSources         []source.Interface
 	DstPath           string
+	// additional destination folders, e.g. on other disks. Runs are spread
+	// between DstPath and these folders according to Placement, metadata of
+	// run and spilled inputs are written into DstPath only
+	ExtraDstPaths     []string
+	// PlacementRoundRobin (default) or PlacementPartition
+	Placement         string
+	// id of run, its runs are written into folders <destination>/RunID.
+	// Empty means new id is generated
+	RunID             string
 	Prefix            string
-	IPIteratorCount   int
+	IPReaderCount     int
+	PartitionCount    int
 	ElementsPerStage  int
 	IPReaderPageSize  int
 	IPReaderCacheSize int
 	BTDegree          int
+
+	// count of ips sampled from IPFilePaths to compute partition bounds.
+	// Zero means ip space is split into equal ranges.
+	PartitionSampleSize int
+
+	// copy inputs which can be read only sequentially (StdinPath, pipes,
+	// fifos, gzip and bzip2 files) into temporary files in DstPath before
+	// reading, so they can be sampled and read by segments in parallel
+	SpillInput bool
+
+	// receives progress of reading inputs every ProgressInterval. Nil means
+	// progress isn't reported, zero interval means one second
+	Progress         progress.Reporter
+	ProgressInterval time.Duration
+
+	// metrics updated while writing, nil means metrics are not exposed
+	Metrics *Metrics
+
+	// limit bytes read from inputs and bytes of runs and spilled inputs
+	// written into destination folders per second, nil means unlimited
+	ReadLimiter  *util.RateLimiter
+	WriteLimiter *util.RateLimiter
+	// hint OS that inputs and runs don't need to stay in page cache
+	LowPriority  bool
 }
 
 type ReadConfigs struct {
-	ArrayListPerStage        [][]*Array
+	ArrayListPerStage        [][]*Run
 	ParallelArrayReaderCount int
 	ArrayIteratorCacheSize   int
+	// count of inputs. If there are several inputs, unique count is
+	// calculated for each of them too
+	SourceCount              int
+
+	// receives progress of merging arrays, see WrtieConfigs.Progress
+	Progress         progress.Reporter
+	ProgressInterval time.Duration
+
+	// metrics updated while merging, nil means metrics are not exposed
+	Metrics *Metrics
+
+	// limits bytes read from runs per second, nil means unlimited
+	ReadLimiter *util.RateLimiter
+}
+
+type ReadIntervalConfigs struct {
+	ArrayListPerStage        [][]*IntervalArray
+	ParallelArrayReaderCount int
+	ArrayIteratorCacheSize   int
+
+	// receives progress of merging arrays, see WrtieConfigs.Progress
+	Progress         progress.Reporter
+	ProgressInterval time.Duration
+
+	// metrics updated while merging, nil means metrics are not exposed
+	Metrics *Metrics
+
+	// limits bytes read from runs per second, nil means unlimited
+	ReadLimiter *util.RateLimiter
 }
 
 type BTree = btree.BTree[IP]
 
 type Array = array.Array[IP]
 
+// on-disk array of sorted unique ips read from single input
+type Run struct {
+	*Array
+	// index of input ips were read from
+	Source int
+}
+
+type IntervalArray = array.Array[Interval]
+
 // btree key (aka ip). Implements btree.Key interface
 type IP uint32
 
@@ -43,3 +123,23 @@ func (k IP) Compare(k2 util.Comparable) int {
 	}
 	return 0
 }
+
+// inclusive range of ips. Implements util.Comparable interface, intervals are
+// ordered by start and then by end
+type Interval struct {
+	Start IP
+	End   IP
+}
+
+func (k Interval) Compare(k2 util.Comparable) int {
+	k2Casted := k2.(Interval)
+	if c := k.Start.Compare(k2Casted.Start); c != 0 {
+		return c
+	}
+	return k.End.Compare(k2Casted.End)
+}
+
+// returns count of ips covered by interval
+func (k Interval) Len() uint64 {
+	return uint64(k.End) - uint64(k.Start) + 1
+}
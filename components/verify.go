@@ -0,0 +1,335 @@
+package components
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/util"
+)
+
+// exact methods of counting unique ips used by Reference
+const (
+	ReferenceAuto   = "auto"
+	ReferenceMap    = "map"
+	ReferenceBitmap = "bitmap"
+)
+
+// inputs smaller than this size are counted by map with ReferenceAuto method
+const referenceMapMaxSize = 16 * 1024 * 1024
+
+// size of buffer for reading lines by Reference, longer lines are invalid
+const referenceLineSize = 64 * 1024
+
+type ReferenceResult struct {
+	// ReferenceMap or ReferenceBitmap
+	Method         string
+	// names of inputs indexed by source
+	Inputs         []string
+	Lines          uint64
+	Invalid        uint64
+	// count of unique ips across all inputs, or covered addresses in interval mode
+	Unique         uint64
+	// count of unique ips of each input, nil unless ReferenceMap method is used
+	UniquePerInput []uint64
+	Duration       time.Duration
+}
+
+// counts unique ips (covered addresses if intervals is true) of inputs
+// exactly, without partitions and on-disk arrays, for verification of Write
+// and Read results. Lines are parsed independently from ip package. Map of
+// seen ips is used for small inputs and bitmap of whole ip space (512MB)
+// otherwise. Inputs are opened again, so StdinPath and IPSources closed by
+// Write can't be verified.
+func Reference(cfg *WrtieConfigs, method string, intervals bool) *ReferenceResult {
+	start := time.Now()
+	in := openInputs(cfg, cfg.DstPath, false)
+	defer in.close()
+
+	if method == ReferenceAuto {
+		method = ReferenceBitmap
+		if _, total := in.progress(); !intervals && total != 0 && total < referenceMapMaxSize {
+			method = ReferenceMap
+		}
+	}
+
+	var countLine func(source int, line []byte) bool
+	var unique func() (uint64, []uint64)
+	readers := cfg.IPReaderCount
+	switch method {
+	case ReferenceMap:
+		if intervals {
+			panic(fmt.Errorf("%s reference method doesn't support intervals", method))
+		}
+		// ips of inputs tagged with source, maps aren't safe for concurrent use
+		readers = 1
+		seen := map[sourcedIP]struct{}{}
+		countLine = func(source int, line []byte) bool {
+			v, ok := parseReferenceIP(line)
+			if ok {
+				seen[sourcedIP(v) << 32 | sourcedIP(source)] = struct{}{}
+			}
+			return ok
+		}
+		unique = func() (uint64, []uint64) {
+			ips := map[IP]struct{}{}
+			perInput := make([]uint64, len(in.inputNames()))
+			for v := range seen {
+				ips[v.ip()] = struct{}{}
+				perInput[v.source()]++
+			}
+			return uint64(len(ips)), perInput
+		}
+	case ReferenceBitmap:
+		// bit per address of whole ip space
+		seen := util.NewBitmap(ip.MaxIpAddrValue + 1)
+		countLine = func(_ int, line []byte) bool {
+			var from, to uint32
+			ok := false
+			if intervals {
+				from, to, ok = parseReferenceRange(line)
+			} else {
+				from, ok = parseReferenceIP(line)
+				to = from
+			}
+			if ok {
+				seen.Set(uint64(from), uint64(to))
+			}
+			return ok
+		}
+		unique = func() (uint64, []uint64) {
+			return seen.Count(), nil
+		}
+	default:
+		panic(fmt.Errorf("unknown reference method %q", method))
+	}
+
+	// whole inputs are read line by line, without splitting them into segments
+	inputJobs := in.jobs(1, ip.MaxRangeSize)
+	jobs := make(chan ip.Job, len(inputJobs))
+	for _, job := range inputJobs {
+		jobs <- job
+	}
+	close(jobs)
+
+	lines, invalid := uint64(0), uint64(0)
+	wg := &sync.WaitGroup{}
+	for range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				for segment := range job {
+					n, bad := uint64(0), uint64(0)
+					eachLine(segment, func(line []byte) {
+						n++
+						if !countLine(segment.Source, line) {
+							bad++
+						}
+					})
+					atomic.AddUint64(&lines, n)
+					atomic.AddUint64(&invalid, bad)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result := &ReferenceResult{
+		Method:   method,
+		Inputs:   in.inputNames(),
+		Lines:    lines,
+		Invalid:  invalid,
+		Duration: time.Since(start),
+	}
+	result.Unique, result.UniquePerInput = unique()
+	return result
+}
+
+// calls fn for each line of r without line ending. Lines longer than
+// referenceLineSize are passed as nil
+func eachLine(r io.Reader, fn func(line []byte)) {
+	br := bufio.NewReaderSize(r, referenceLineSize)
+	long := false
+	for {
+		line, err := br.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = true
+			continue
+		} else if err != nil && err != io.EOF {
+			util.PanicIfErr(err)
+		}
+
+		if len(line) > 0 {
+			line = bytes.TrimSuffix(line, []byte{'\n'})
+			line = bytes.TrimSuffix(line, []byte{'\r'})
+			if long {
+				line = nil
+			}
+			fn(line)
+		}
+		long = false
+
+		if err == io.EOF {
+			return
+		}
+	}
+}
+
+// parses dotted decimal ipv4 address of exactly 4 octets of 1-3 digits
+func parseReferenceIP(src []byte) (uint32, bool) {
+	v := uint32(0)
+	for i := range 4 {
+		octet := src
+		if i < 3 {
+			end := bytes.IndexByte(src, '.')
+			if end == -1 {
+				return 0, false
+			}
+			octet, src = src[:end], src[end+1:]
+		}
+		if len(octet) == 0 || len(octet) > 3 {
+			return 0, false
+		}
+
+		n := uint32(0)
+		for _, c := range octet {
+			if c < '0' || c > '9' {
+				return 0, false
+			}
+			n = n * 10 + uint32(c - '0')
+		}
+		if n > 255 {
+			return 0, false
+		}
+		v = v << 8 | n
+	}
+	return v, true
+}
+
+// parses single ip, range ("1.2.3.0-1.2.5.255") or CIDR ("10.0.0.0/8") into
+// inclusive range of addresses
+func parseReferenceRange(src []byte) (from, to uint32, ok bool) {
+	if start, end, found := bytes.Cut(src, []byte{'-'}); found {
+		from, ok1 := parseReferenceIP(bytes.TrimSpace(start))
+		to, ok2 := parseReferenceIP(bytes.TrimSpace(end))
+		return from, to, ok1 && ok2 && from <= to
+	}
+
+	if addr, prefixLen, found := bytes.Cut(src, []byte{'/'}); found {
+		v, ok := parseReferenceIP(addr)
+		n, err := strconv.ParseUint(string(prefixLen), 10, 8)
+		if !ok || err != nil || n > 32 {
+			return 0, 0, false
+		}
+		size := uint64(1) << (32 - n)
+		from := uint32(uint64(v) &^ (size - 1))
+		return from, uint32(uint64(from) + size - 1), true
+	}
+
+	v, ok := parseReferenceIP(src)
+	return v, v, ok
+}
+
+// checks that ranges of partitions are ordered, don't overlap, cover whole
+// ip space and that bounds of ranges are routed into their partitions. Empty
+// partitions are skipped.
+func CheckPartitions(partitioner *ip.Partitioner) []error {
+	errs := []error{}
+	next := uint64(0)
+	for i := range partitioner.Count() {
+		if partitioner.Empty(i) {
+			continue
+		}
+		from, to := partitioner.Range(i)
+		if to > ip.MaxIpAddrValue {
+			errs = append(errs, fmt.Errorf("partition %d range ends after max ip: %d", i, to))
+			break
+		}
+		if from != next {
+			errs = append(errs, fmt.Errorf(
+				"partition %d range %s doesn't start right after previous partitions, expected %s",
+				i, RangeString(partitioner, i), ip.ToString(uint32(next)),
+			))
+		}
+		if partitioner.Index(uint32(from)) != i || partitioner.Index(uint32(to)) != i {
+			errs = append(errs, fmt.Errorf(
+				"bounds of partition %d range %s are routed into partitions %d and %d",
+				i, RangeString(partitioner, i), partitioner.Index(uint32(from)), partitioner.Index(uint32(to)),
+			))
+		}
+		next = max(next, to + 1)
+	}
+	if next != ip.MaxIpAddrValue + 1 {
+		errs = append(errs, fmt.Errorf("partitions don't cover ips after %s", ip.ToString(uint32(next))))
+	}
+	return errs
+}
+
+// checks that runs of each partition are strictly ascending and hold only ips
+// of their partition
+func CheckRuns(partitioner *ip.Partitioner, runs [][]*Run, cacheSize int) []error {
+	errs := []error{}
+	for i, list := range runs {
+		from, to := partitioner.Range(i)
+		for j, run := range list {
+			count, prev := uint64(0), uint64(0)
+			for v := range run.Iterator(cacheSize, nil) {
+				if count > 0 && uint64(v) <= prev {
+					errs = append(errs, fmt.Errorf(
+						"partition %d run %d isn't strictly ascending at %d: %s after %s",
+						i, j, count, ip.ToString(uint32(v)), ip.ToString(uint32(prev)),
+					))
+					break
+				} else if uint64(v) < from || uint64(v) > to {
+					errs = append(errs, fmt.Errorf(
+						"partition %d run %d holds %s out of partition range %s",
+						i, j, ip.ToString(uint32(v)), RangeString(partitioner, i),
+					))
+					break
+				}
+				prev = uint64(v)
+				count++
+			}
+		}
+	}
+	return errs
+}
+
+// same as CheckRuns for interval runs. Intervals of run must be ascending and
+// must not overlap
+func CheckIntervalRuns(partitioner *ip.Partitioner, runs [][]*IntervalArray, cacheSize int) []error {
+	errs := []error{}
+	for i, list := range runs {
+		from, to := partitioner.Range(i)
+		for j, run := range list {
+			count, prev := uint64(0), Interval{}
+			for v := range run.Iterator(cacheSize, nil) {
+				if v.Start > v.End || count > 0 && v.Start <= prev.End {
+					errs = append(errs, fmt.Errorf(
+						"partition %d run %d isn't ascending or overlaps at %d: %s - %s after %s - %s",
+						i, j, count,
+						ip.ToString(uint32(v.Start)), ip.ToString(uint32(v.End)),
+						ip.ToString(uint32(prev.Start)), ip.ToString(uint32(prev.End)),
+					))
+					break
+				} else if uint64(v.Start) < from || uint64(v.End) > to {
+					errs = append(errs, fmt.Errorf(
+						"partition %d run %d holds %s - %s out of partition range %s",
+						i, j, ip.ToString(uint32(v.Start)), ip.ToString(uint32(v.End)), RangeString(partitioner, i),
+					))
+					break
+				}
+				prev = v
+				count++
+			}
+		}
+	}
+	return errs
+}
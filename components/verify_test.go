@@ -0,0 +1,106 @@
+package components
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	array "ip_addr_counter/pkg/array/generic"
+	"ip_addr_counter/pkg/file"
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/util"
+)
+
+func TestCheckPartitions(t *testing.T) {
+	tests := []struct {
+		name        string
+		partitioner *ip.Partitioner
+	}{
+		{"uniform", ip.UniformPartitioner(20)},
+		{"quantile", ip.QuantilePartitioner([]uint32{1, 1 << 8, 1 << 16, 1 << 24, 1 << 31}, 4)},
+		// empty leading partitions of skewed samples
+		{"zero samples", ip.QuantilePartitioner([]uint32{0, 0, 0, 0, 1 << 20, 1 << 21, 1 << 22, 1 << 23}, 4)},
+		{"max samples", ip.QuantilePartitioner([]uint32{ip.MaxIpAddrValue, ip.MaxIpAddrValue}, 3)},
+	}
+
+	for _, tt := range tests {
+		if errs := CheckPartitions(tt.partitioner); len(errs) > 0 {
+			t.Errorf("%s: %v", tt.name, errs)
+		}
+		for i := range tt.partitioner.Count() {
+			if s := RangeString(tt.partitioner, i); s == "0.0.0.0 - 255.255.255.255" && tt.partitioner.Count() > 1 {
+				t.Errorf("%s: partition %d covers whole ip space", tt.name, i)
+			}
+		}
+	}
+}
+
+// map and bitmap reference methods count the same lines, invalid lines and
+// unique ips as Write and Read
+func TestReference(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, dir, "a.txt", append(testLines(1 << 24, 3000), "bad\n\n10.0.0.256\n"...))
+	writeTestFile(t, dir, "b.gz", gzipData(testLines(1 << 24 + 1000, 2000)))
+	cfg := testConfigs(t, filepath.Join(dir, "*"))
+	read, write := countTest(t, cfg)
+
+	for _, method := range []string{ReferenceMap, ReferenceBitmap, ReferenceAuto} {
+		ref := Reference(cfg, method, false)
+		if ref.Lines != write.Lines || ref.Invalid != write.Invalid || ref.Unique != read.UniqCount {
+			t.Errorf(
+				"%s: lines %d, invalid %d, unique %d, expected %d, %d and %d",
+				method, ref.Lines, ref.Invalid, ref.Unique, write.Lines, write.Invalid, read.UniqCount,
+			)
+		}
+		if !slices.Equal(ref.Inputs, write.Inputs) {
+			t.Errorf("%s: inputs %q, expected %q", method, ref.Inputs, write.Inputs)
+		}
+		// small inputs are counted by map
+		if method != ReferenceBitmap && !slices.Equal(ref.UniquePerInput, read.UniqCountPerInput) {
+			t.Errorf("%s: unique per input %v, expected %v", method, ref.UniquePerInput, read.UniqCountPerInput)
+		}
+	}
+	if write.Invalid != 3 || read.UniqCount != 2000 {
+		t.Errorf("invalid %d, unique %d, expected 3 and 2000", write.Invalid, read.UniqCount)
+	}
+}
+
+// returns in-memory run of values
+func memoryRun(values ...IP) *Run {
+	vf := file.Virtual()
+	util.PanicIfErr(vf.Truncate(uint64(len(values)) * uint64(ipSize)))
+	arr := array.New[IP](vf, uint64(len(values)))
+	for i := range values {
+		arr.Set(uint64(i), &values[i])
+	}
+	return &Run{Array: arr}
+}
+
+// runs written by Write pass checks, unordered runs and runs holding ips of
+// other partitions don't
+func TestCheckRuns(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "ips.txt", testLines(1 << 24, 20_000))
+	write := Write(testConfigs(t, path))
+	defer write.Remove()
+	if errs := CheckRuns(write.Partitioner, write.Runs, 64); len(errs) > 0 {
+		t.Errorf("runs of Write: %v", errs)
+	}
+
+	partitioner := ip.UniformPartitioner(2)
+	for _, test := range []struct {
+		name  string
+		runs  [][]*Run
+		error string
+	}{
+		{"ascending", [][]*Run{{memoryRun(1, 2, 5)}, {memoryRun(1 << 31, 1 << 31 + 1)}}, ""},
+		{"duplicates", [][]*Run{{memoryRun(1, 2, 2, 5)}, {}}, "isn't strictly ascending at 2"},
+		{"descending", [][]*Run{{}, {memoryRun(1 << 31 + 1, 1 << 31)}}, "partition 1 run 0 isn't strictly ascending"},
+		{"other partition", [][]*Run{{memoryRun(1, 1 << 31)}, {}}, "out of partition range"},
+	} {
+		errs := CheckRuns(partitioner, test.runs, 64)
+		if test.error == "" && len(errs) > 0 || test.error != "" && (len(errs) != 1 || !strings.Contains(errs[0].Error(), test.error)) {
+			t.Errorf("%s: errors %v, expected %q", test.name, errs, test.error)
+		}
+	}
+}
@@ -1,90 +1,167 @@
 package components
 
 import (
-	"fmt"
+	"context"
 	"iter"
-	"os"
+	"log/slog"
+	"runtime/trace"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"ip_addr_counter/pkg/btree"
 	"ip_addr_counter/pkg/ip"
-	"ip_addr_counter/pkg/util"
+	"ip_addr_counter/pkg/progress"
 )
 
-func Write(cfg *WrtieConfigs) [][]*Array {
-	// opening file with raw ip addresses
-	ipFile := util.Must(os.OpenFile(cfg.IPFilePath, os.O_RDONLY, os.ModePerm))
-
-	// breaking file into equal size segments (ipIteratorCount), for parallel reading
-	ipIterators := ip.Iterator(ipFile, cfg.IPReaderPageSize, cfg.IPReaderCacheSize, cfg.IPIteratorCount)
-
-	// slice of on-disk arrays. Each []Array is list of on-disk arrays stored
-	// in files and read from single segment
-	arrListPerStage := make([][]*Array, cfg.IPIteratorCount)
-
-	// count of ips read from ip file and written into btrees
-	writeCount := uint64(0)
+// reads ips of all inputs into sorted on-disk runs. Returns runs of each
+// partition and statistics, Run.Source indexes WriteStats.Inputs
+func Write(cfg *WrtieConfigs) *WriteResult {
+	start := time.Now()
+	ctx, task := trace.NewTask(context.Background(), "write")
+	defer task.End()
+
+	// opening files (or streams) with raw ip addresses
+	// runs and spilled inputs are written into own locked folder, see
+	// WriteStats.Dir
+	run := newRunDir(cfg)
+	in := run.openInputs(cfg)
+	defer in.close()
+
+	// counts of read and invalid lines
+	stats := &ip.Stats{}
+	m := metricsOrNop(cfg.Metrics)
+	m.stats.Store(stats)
+	m.SetPhase("write")
+
+	// computing partition bounds, each partition is processed by its own
+	// goroutine and is written into its own arrays
+	partitioner := newPartitioner(cfg, in, ip.MaxIpAddrSize)
+
+	// breaking files into segments of roughly equal size, for parallel reading
+	// by IPReaderCount readers. Streams are read by single reader.
+	// Each reader routes values into all partitions
+	ipIterators := ip.Iterator(
+		in.jobs(cfg.IPReaderCount, ip.MaxIpAddrSize),
+		cfg.IPReaderCount,
+		cfg.IPReaderPageSize,
+		cfg.IPReaderCacheSize,
+		partitioner,
+		stats,
+		cfg.ReadLimiter,
+	)
+
+	// slice of on-disk arrays. Each []Run is list of on-disk arrays stored
+	// in files and holding ips of single partition
+	arrListPerStage := make([][]*Run, cfg.PartitionCount)
+
+	// count of values routed into each partition and flushed arrays
+	partitions := make([]PartitionWriteStats, cfg.PartitionCount)
 
 	elementsPerStage := uint64(cfg.ElementsPerStage)
 	arrVirtualFileSize := elementsPerStage * uint64(ipSize)
 
-	// printing progress each second
-	stop := util.SetInterval(func(start, now time.Time) {
-		sec := now.Sub(start).Seconds()
-		fmt.Printf(
-			"writeCount %d, sec %d, eps %d\n",
-			writeCount, uint64(sec), writeCount / uint64(sec),
-		)
-	}, time.Second)
-	defer stop()
+	// reporting progress of reading inputs
+	stop := reportProgress(cfg.Progress, cfg.ProgressInterval, func(elapsed time.Duration) progress.Snapshot {
+		read, total := in.progress()
+		return progress.Snapshot{
+			Phase:      "write",
+			Elapsed:    elapsed,
+			Bytes:      read,
+			TotalBytes: total,
+			Count:      atomic.LoadUint64(&stats.Lines),
+			Invalid:    atomic.LoadUint64(&stats.Invalid),
+		}
+	})
 
 	wg := &sync.WaitGroup{}
 	for i, ipIterator := range ipIterators {
 		wg.Add(1)
-		// reading each segment in separate goroutine
-		go func (i int, ipIterator iter.Seq[uint32]) {
+		// writing each partition in separate goroutine
+		go func (i int, ipIterator iter.Seq2[int, uint32]) {
 			defer wg.Done()
 			var stageWG *sync.WaitGroup
+			inserts := &localCounter{c: m.inserts.WithInt(i)}
+			defer inserts.flush()
+
+			// region of inserting values of single stage
+			region := trace.StartRegion(ctx, "insert")
 			stage := 0
 
-			// initializing current btree
-			current := btree.New[IP](cfg.BTDegree)
+			// initializing btree per input, so unique ips of each input can be
+			// counted while merging. count is total count of ips in btrees
+			current := map[int]*BTree{}
+			count := uint64(0)
 
 			// prepare helper function which will move filled in-memory btree
 			// into on-disk sorted array
-			processStage := stageProcessor(cfg.DstPath, cfg.Prefix, i, arrVirtualFileSize, &arrListPerStage[i])
-
-			for ip := range ipIterator {
-				atomic.AddUint64(&writeCount, 1)
-				current.Put(IP(ip))
-
-				// checking if btree is filled enough to store in on-disk array
-				if current.Count() == elementsPerStage {
-					fmt.Println("STAGE0", i, "|", stage, "|", writeCount)
-					// flushing btree data into on-disk array and creating new one
-					stageWG = processStage(current)
-					current = btree.New[IP](cfg.BTDegree)
+			processStage := stageProcessor[IP](cfg, run.dirs, i, arrVirtualFileSize, m)
+
+			// flushing btrees data into on-disk arrays
+			flush := func() *sync.WaitGroup {
+				var wg *sync.WaitGroup
+				for source, bt := range current {
+					wg = processStage(bt.Iterator(), bt.Count(), func(arr *Array) {
+						arrListPerStage[i] = append(arrListPerStage[i], &Run{arr, source})
+						partitions[i].Runs++
+						partitions[i].RunBytes += arr.Len() * uint64(ipSize)
+					})
+				}
+				current = map[int]*BTree{}
+				count = 0
+				return wg
+			}
+
+			for source, ip := range ipIterator {
+				partitions[i].Load++
+				inserts.inc()
+
+				bt, ok := current[source]
+				if !ok {
+					bt = btree.New[IP](cfg.BTDegree)
+					current[source] = bt
+				}
+				if bt.Put(IP(ip)) {
+					count++
+				}
+
+				// checking if btrees are filled enough to store in on-disk arrays
+				if count == elementsPerStage {
+					slog.Info(
+						"flushing stage", "partition", i, "stage", stage, "values", count,
+						"lines", atomic.LoadUint64(&stats.Lines), "elapsed", time.Since(start),
+					)
+					region.End()
+					stageWG = flush()
+					region = trace.StartRegion(ctx, "insert")
 					stage++
 				}
 			}
 
 			// checking if processStage was executed at least once
+			region.End()
 			if stageWG != nil {
 				// wait if previous stage processing didn't finished 
 				stageWG.Wait()
 			}
 
 			// check if segment wasn't completely read and some in-memory data left
-			if current.Count() != elementsPerStage && current.Count() > 0 {
-				fmt.Println("STAGE1", i, "|", stage, "|", writeCount)
+			if count > 0 {
+				slog.Info(
+					"flushing last stage", "partition", i, "stage", stage, "values", count,
+					"lines", atomic.LoadUint64(&stats.Lines), "elapsed", time.Since(start),
+				)
 				// process rest data
-				processStage(current).Wait()
+				flush().Wait()
 			}
 		}(i, ipIterator)
 	}
 
 	wg.Wait() // waiting for ip file to be completely read
-	return arrListPerStage
+	stop()
+	logPartitionLoads(partitioner, partitions)
+	return &WriteResult{
+		Runs:       arrListPerStage,
+		WriteStats: in.writeStats(run, stats, partitioner, partitions, start),
+	}
 }
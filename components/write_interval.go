@@ -0,0 +1,176 @@
+package components
+
+import (
+	"context"
+	"iter"
+	"log/slog"
+	"runtime/trace"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/progress"
+)
+
+// same as Write, but ip file lines may contain ranges and CIDRs in addition to
+// single ips. Intervals are collected into slices, sorted, merged and written
+// into on-disk arrays of non-overlapping intervals.
+func WriteIntervals(cfg *WrtieConfigs) *WriteIntervalResult {
+	start := time.Now()
+	ctx, task := trace.NewTask(context.Background(), "write")
+	defer task.End()
+
+	// opening files (or streams) with raw ip ranges
+	// runs and spilled inputs are written into own locked folder, see
+	// WriteStats.Dir
+	run := newRunDir(cfg)
+	in := run.openInputs(cfg)
+	defer in.close()
+
+	// counts of read and invalid lines
+	stats := &ip.Stats{}
+	m := metricsOrNop(cfg.Metrics)
+	m.stats.Store(stats)
+	m.SetPhase("write")
+
+	// computing partition bounds, each partition is processed by its own
+	// goroutine and is written into its own arrays
+	partitioner := newPartitioner(cfg, in, ip.MaxRangeSize)
+
+	// breaking files into segments of roughly equal size, for parallel reading
+	// by IPReaderCount readers. Streams are read by single reader.
+	// Each reader routes values into all partitions
+	rangeIterators := ip.RangeIterator(
+		in.jobs(cfg.IPReaderCount, ip.MaxRangeSize),
+		cfg.IPReaderCount,
+		cfg.IPReaderPageSize,
+		cfg.IPReaderCacheSize,
+		partitioner,
+		stats,
+		cfg.ReadLimiter,
+	)
+
+	// slice of on-disk arrays. Each []IntervalArray is list of on-disk arrays
+	// stored in files and holding intervals of single partition
+	arrListPerStage := make([][]*IntervalArray, cfg.PartitionCount)
+
+	// count of values routed into each partition and flushed arrays
+	partitions := make([]PartitionWriteStats, cfg.PartitionCount)
+
+	elementsPerStage := cfg.ElementsPerStage
+	arrVirtualFileSize := uint64(elementsPerStage) * uint64(intervalSize)
+
+	// reporting progress of reading inputs
+	stop := reportProgress(cfg.Progress, cfg.ProgressInterval, func(elapsed time.Duration) progress.Snapshot {
+		read, total := in.progress()
+		return progress.Snapshot{
+			Phase:      "write",
+			Elapsed:    elapsed,
+			Bytes:      read,
+			TotalBytes: total,
+			Count:      atomic.LoadUint64(&stats.Lines),
+			Invalid:    atomic.LoadUint64(&stats.Invalid),
+		}
+	})
+
+	wg := &sync.WaitGroup{}
+	for i, rangeIterator := range rangeIterators {
+		wg.Add(1)
+		// writing each partition in separate goroutine
+		go func (i int, rangeIterator iter.Seq2[int, ip.Range]) {
+			defer wg.Done()
+			var stageWG *sync.WaitGroup
+			inserts := &localCounter{c: m.inserts.WithInt(i)}
+			defer inserts.flush()
+
+			// region of inserting values of single stage
+			region := trace.StartRegion(ctx, "insert")
+			stage := 0
+
+			current := make([]Interval, 0, elementsPerStage)
+
+			// prepare helper function which will move filled in-memory intervals
+			// into on-disk sorted array
+			processStage := stageProcessor[Interval](cfg, run.dirs, i, arrVirtualFileSize, m)
+			done := func(arr *IntervalArray) {
+				arrListPerStage[i] = append(arrListPerStage[i], arr)
+				partitions[i].Runs++
+				partitions[i].RunBytes += arr.Len() * uint64(intervalSize)
+			}
+
+			// covered addresses are counted across all inputs, so input of
+			// range is ignored
+			for _, r := range rangeIterator {
+				partitions[i].Load++
+				inserts.inc()
+				current = append(current, Interval{IP(r.From), IP(r.To)})
+
+				if len(current) == elementsPerStage {
+					trace.WithRegion(ctx, "merge intervals", func() {
+						current = mergeIntervals(current)
+					})
+
+					// heavily overlapping ranges collapse well, so there is no need
+					// to flush them until at least half of the slice is filled
+					if len(current) > elementsPerStage / 2 {
+						slog.Info(
+							"flushing stage", "partition", i, "stage", stage, "values", uint64(len(current)),
+							"lines", atomic.LoadUint64(&stats.Lines), "elapsed", time.Since(start),
+						)
+						region.End()
+						stageWG = processStage(slices.Values(current), uint64(len(current)), done)
+						region = trace.StartRegion(ctx, "insert")
+						current = make([]Interval, 0, elementsPerStage)
+						stage++
+					}
+				}
+			}
+
+			region.End()
+			if stageWG != nil {
+				// wait if previous stage processing didn't finished
+				stageWG.Wait()
+			}
+
+			// check if some in-memory data left
+			if len(current) > 0 {
+				slog.Info(
+					"flushing last stage", "partition", i, "stage", stage, "values", uint64(len(current)),
+					"lines", atomic.LoadUint64(&stats.Lines), "elapsed", time.Since(start),
+				)
+				trace.WithRegion(ctx, "merge intervals", func() {
+					current = mergeIntervals(current)
+				})
+				processStage(slices.Values(current), uint64(len(current)), done).Wait()
+			}
+		}(i, rangeIterator)
+	}
+
+	wg.Wait() // waiting for ip file to be completely read
+	stop()
+	logPartitionLoads(partitioner, partitions)
+	return &WriteIntervalResult{
+		Runs:       arrListPerStage,
+		WriteStats: in.writeStats(run, stats, partitioner, partitions, start),
+	}
+}
+
+// sorts intervals and unions overlapping ones in place
+func mergeIntervals(intervals []Interval) []Interval {
+	slices.SortFunc(intervals, func(a, b Interval) int {
+		return a.Compare(b)
+	})
+
+	merged := intervals[:0]
+	for _, in := range intervals {
+		last := len(merged) - 1
+		if last >= 0 && in.Start <= merged[last].End {
+			merged[last].End = max(merged[last].End, in.End)
+		} else {
+			merged = append(merged, in)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,122 @@
+package components
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"ip_addr_counter/pkg/ip"
+)
+
+func TestMergeIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals []Interval
+		merged    []Interval
+	}{
+		{"empty", []Interval{}, []Interval{}},
+		{"disjoint", []Interval{{5, 6}, {1, 2}}, []Interval{{1, 2}, {5, 6}}},
+		{"overlapping", []Interval{{1, 5}, {3, 8}, {8, 9}}, []Interval{{1, 9}}},
+		{"contained", []Interval{{1, 10}, {2, 3}, {4, 4}}, []Interval{{1, 10}}},
+		{"duplicates", []Interval{{7, 7}, {7, 7}, {1, 3}, {1, 3}}, []Interval{{1, 3}, {7, 7}}},
+		// adjacent intervals don't overlap, covered count is the same
+		{"adjacent", []Interval{{4, 6}, {1, 3}}, []Interval{{1, 3}, {4, 6}}},
+		{"whole space", []Interval{{0, ip.MaxIpAddrValue}, {5, 6}, {ip.MaxIpAddrValue, ip.MaxIpAddrValue}}, []Interval{{0, ip.MaxIpAddrValue}}},
+	}
+
+	for _, tt := range tests {
+		merged := mergeIntervals(slices.Clone(tt.intervals))
+		if !slices.Equal(merged, tt.merged) {
+			t.Errorf("%s: merged %v, expected %v", tt.name, merged, tt.merged)
+		}
+	}
+}
+
+// counts covered addresses of inputs of cfg by WriteIntervals and ReadIntervals
+func countIntervalsTest(t *testing.T, cfg *WrtieConfigs) (uint64, WriteStats) {
+	t.Helper()
+	write := WriteIntervals(cfg)
+	read := ReadIntervals(&ReadIntervalConfigs{
+		ArrayListPerStage:        write.Runs,
+		ParallelArrayReaderCount: 2,
+		ArrayIteratorCacheSize:   64,
+	})
+	if errs := CheckIntervalRuns(write.Partitioner, write.Runs, 64); len(errs) > 0 {
+		t.Error(errs)
+	}
+	write.Remove()
+	return read.CoveredCount, write.WriteStats
+}
+
+// overlapping and adjacent ranges crossing partition bounds, merged from
+// several runs of each partition
+func TestIntervalsAcrossPartitions(t *testing.T) {
+	lines := []string{
+		// crosses 64.0.0.0 bound of uniform partitions, adjacent /24 follows
+		// and contained range adds nothing: 768
+		"63.255.255.0-64.0.0.255",
+		"64.0.1.0/24",
+		"63.255.255.128-63.255.255.255",
+		// ends at 128.0.0.0 bound, overlapping ranges extend it by 2
+		"127.0.0.0/8",
+		"127.255.255.255-128.0.0.0",
+		"128.0.0.0/31",
+		// duplicated and adjacent single ips: 2
+		"200.0.0.1",
+		"200.0.0.1\r",
+		"200.0.0.2",
+		// overlapping: 21
+		"10.0.0.0-10.0.0.9",
+		"10.0.0.5 - 10.0.0.20",
+		// invalid
+		"10.0.0.9-10.0.0.1",
+		"1.2.3.4/33",
+	}
+	// 6000 addresses crossing 192.0.0.0 bound. Ranges of each set don't
+	// overlap, so they aren't collapsed in memory and are flushed into
+	// several runs, but all sets together cover continuous range
+	base := uint32(191 << 24 | 255 << 16 | 240 << 8)
+	for set := range 3 {
+		for i := range uint32(1500) {
+			from := base + 4 * i + uint32(set)
+			to := from + 1
+			if set == 2 {
+				from, to = from + 1, from + 1
+			}
+			lines = append(lines, ip.ToString(from) + "-" + ip.ToString(to))
+		}
+	}
+	expected := uint64(768 + 16777216 + 2 + 2 + 21 + 6000)
+
+	for _, sampleSize := range []int{0, 1024} {
+		t.Run(fmt.Sprintf("sample size %d", sampleSize), func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeTestFile(t, dir, "ranges.txt", []byte(strings.Join(lines, "\n")))
+			cfg := testConfigs(t, path)
+			cfg.PartitionSampleSize = sampleSize
+
+			covered, write := countIntervalsTest(t, cfg)
+			if covered != expected {
+				t.Errorf("covered %d, expected %d", covered, expected)
+			}
+			if write.Lines != uint64(len(lines)) || write.Invalid != 2 {
+				t.Errorf("lines %d, invalid %d, expected %d and 2", write.Lines, write.Invalid, len(lines))
+			}
+			runs := 0
+			for _, p := range write.Partitions {
+				runs += p.Runs
+			}
+			if runs <= cfg.PartitionCount {
+				t.Errorf("%d runs, expected several runs per partition", runs)
+			}
+		})
+	}
+}
+
+func TestIntervalsWholeSpace(t *testing.T) {
+	path := writeTestFile(t, t.TempDir(), "ranges.txt", []byte("1.2.3.4\n0.0.0.0/0\n255.255.255.255/32\n"))
+	if covered, _ := countIntervalsTest(t, testConfigs(t, path)); covered != uint64(ip.MaxIpAddrValue) + 1 {
+		t.Errorf("covered %d, expected whole ip space", covered)
+	}
+}
@@ -0,0 +1,52 @@
+package components
+
+import (
+	"fmt"
+	"testing"
+)
+
+// count of readers doesn't depend on count of partitions: single reader
+// feeds many partitions and many readers feed single partition
+func TestReadersAndPartitions(t *testing.T) {
+	// ips spread over whole ip space, every ip is repeated twice
+	data := []byte{}
+	for i := range uint32(20_000) {
+		ip := i / 2 * 2654435761
+		data = fmt.Appendf(data, "%d.%d.%d.%d\n", ip >> 24, ip >> 16 & 0xff, ip >> 8 & 0xff, ip & 0xff)
+	}
+	path := writeTestFile(t, t.TempDir(), "ips.txt", data)
+
+	for _, test := range []struct {
+		readers, partitions int
+	}{
+		{1, 1},
+		{1, 8},
+		{8, 1},
+		{3, 5},
+		{16, 2},
+	} {
+		cfg := testConfigs(t, path)
+		cfg.IPReaderCount, cfg.PartitionCount = test.readers, test.partitions
+		read, write := countTest(t, cfg)
+
+		if len(write.Partitions) != test.partitions || len(read.Partitions) != test.partitions {
+			t.Errorf(
+				"%d readers, %d partitions: %d written and %d read partitions",
+				test.readers, test.partitions, len(write.Partitions), len(read.Partitions),
+			)
+		}
+		load := uint64(0)
+		for i, p := range write.Partitions {
+			if p.Load == 0 {
+				t.Errorf("%d readers, %d partitions: partition %d is empty", test.readers, test.partitions, i)
+			}
+			load += p.Load
+		}
+		if load != 20_000 || read.UniqCount != 10_000 {
+			t.Errorf(
+				"%d readers, %d partitions: load %d, unique %d, expected 20000 and 10000",
+				test.readers, test.partitions, load, read.UniqCount,
+			)
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"ip_addr_counter/components"
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// counts unique ips (or covered addresses in interval mode) of input files.
+// Returns exit code
+func count(args []string) int {
+	flags := flag.NewFlagSet("count", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s [count] [flags] [ip files, globs, directories, archives | -]...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	// treat lines of ipFile as ranges ("1.2.3.0-1.2.5.255"), CIDRs or single ips
+	// and count covered addresses instead of unique ones.
+	intervalMode := flags.Bool("intervals", false, "count addresses covered by ranges/CIDRs in ip files")
+	pipeline := pipelineFlags(flags)
+	reportFormat := flags.String("report", "text", "format of result printed into stdout: text or json")
+	progressMode := flags.String("progress", "auto", "progress printed into stderr: bar, log, none or auto (bar on terminal, log otherwise)")
+	progressInterval := flags.Duration("progress-interval", time.Second, "interval of progress reports")
+	metricsAddr := flags.String("metrics-addr", "", "address to serve Prometheus metrics at /metrics, e.g. :9100")
+	explain := flags.Bool("explain", false, "print execution plan with estimated lines, flushes, disk space and memory without counting")
+	expect := flags.String("expect", "", "ground truth file written by generate, exit with code 1 if result doesn't match it")
+	setupLog := logFlags(flags)
+	startProfiling := profileFlags(flags)
+	flags.Parse(args)
+	setupLog()
+
+	// flags are validated before profiling is started, since usage errors
+	// exit immediately
+	var reporter progress.Reporter
+	switch *progressMode {
+	case "auto":
+		reporter = progress.Log(slog.Default())
+		if progress.IsTerminal(os.Stderr) {
+			reporter = progress.Bar(stderr)
+		}
+	case "bar":
+		reporter = progress.Bar(stderr)
+	case "log":
+		reporter = progress.Log(slog.Default())
+	case "none":
+		reporter = progress.Nop()
+	default:
+		usageError(flags, fmt.Errorf("unknown progress mode %q", *progressMode))
+	}
+
+	// diagnostics are logged into stderr, so stdout carries report only
+	var printReport func(w io.Writer, r *report)
+	switch *reportFormat {
+	case "text":
+		printReport = printTextReport
+	case "json":
+		printReport = printJSON[*report]
+	default:
+		usageError(flags, fmt.Errorf("unknown report format %q", *reportFormat))
+	}
+
+	start := time.Now()
+	cfg := pipeline(flags.Args())
+	writeCfg := cfg.write
+	defer startProfiling()()
+
+	if *explain {
+		plan := components.Explain(writeCfg, cfg.parallelReaders, cfg.arrayCacheSize, *intervalMode)
+		if *reportFormat == "json" {
+			printJSON(os.Stdout, plan)
+		} else {
+			printTextPlan(os.Stdout, plan, cfg)
+		}
+		return 0
+	}
+
+	// last snapshot is printed on SIGUSR1 regardless of progress mode
+	recorder := progress.Record(reporter)
+	defer dumpOnSignal(recorder)()
+	writeCfg.Progress = recorder
+	writeCfg.ProgressInterval = *progressInterval
+	progressCfg := progressConfig{recorder, *progressInterval}
+
+	var m *components.Metrics
+	if *metricsAddr != "" {
+		m = serveMetrics(*metricsAddr)
+		defer m.SetPhase("done")
+	}
+	writeCfg.Metrics = m
+
+	if !checkPreflight(cfg, *intervalMode) {
+		return 1
+	}
+
+	if *intervalMode {
+		r := countIntervals(start, cfg, progressCfg)
+		printReport(os.Stdout, r)
+		return checkTruth(*expect, r)
+	}
+
+	slog.Info("writing phase started", "inputs", len(writeCfg.IPFilePaths))
+	write := components.Write(writeCfg)
+
+	for i, arrList := range write.Runs {
+		for j, a := range arrList {
+			slog.Debug("run", "partition", i, "run", j, "len", a.Len(), "file", write.Inputs[a.Source])
+		}
+	}
+
+	slog.Info("reading phase started", "elapsed", time.Since(start))
+	read := components.Read(&components.ReadConfigs{
+		ArrayListPerStage:        write.Runs,
+		ParallelArrayReaderCount: cfg.parallelReaders,
+		ArrayIteratorCacheSize:   cfg.arrayCacheSize,
+		SourceCount:              len(write.Inputs),
+		Progress:                 progressCfg.reporter,
+		ProgressInterval:         progressCfg.interval,
+		Metrics:                  m,
+		ReadLimiter:              writeCfg.ReadLimiter,
+	})
+	cleanup(cfg, &write.WriteStats, write.Remove)
+
+	r := newReport(start, &write.WriteStats, &read.ReadStats)
+	r.Unique = read.UniqCount
+	for i := range r.Inputs {
+		r.Inputs[i].Unique = read.UniqCountPerInput[i]
+	}
+	printReport(os.Stdout, r)
+	slog.Info("done", "unique", r.Unique, "elapsed", time.Since(start))
+	return checkTruth(*expect, r)
+}
+
+// compares report with ground truth file written by generate and returns exit
+// code, 1 on mismatch. Empty path means there is nothing to check
+func checkTruth(path string, r *report) int {
+	if path == "" {
+		return 0
+	}
+
+	truth := readTruth(path)
+	if r.Lines != truth.Lines || r.Invalid != truth.Invalid || r.Unique != truth.Unique {
+		slog.Error(
+			"result doesn't match ground truth", "file", path,
+			"lines", r.Lines, "expected_lines", truth.Lines,
+			"invalid", r.Invalid, "expected_invalid", truth.Invalid,
+			"unique", r.Unique, "expected_unique", truth.Unique,
+		)
+		return 1
+	}
+	slog.Info("result matches ground truth", "file", path)
+	return 0
+}
+
+// progress reporting configuration of reading phase
+type progressConfig struct {
+	reporter progress.Reporter
+	interval time.Duration
+}
+
+func countIntervals(
+	start time.Time,
+	cfg *pipelineConfig,
+	progressCfg progressConfig,
+) *report {
+	writeCfg := cfg.write
+	slog.Info("writing phase started", "inputs", len(writeCfg.IPFilePaths), "mode", "intervals")
+	write := components.WriteIntervals(writeCfg)
+
+	slog.Info("reading phase started", "elapsed", time.Since(start))
+	read := components.ReadIntervals(&components.ReadIntervalConfigs{
+		ArrayListPerStage:        write.Runs,
+		ParallelArrayReaderCount: cfg.parallelReaders,
+		ArrayIteratorCacheSize:   cfg.arrayCacheSize,
+		Progress:                 progressCfg.reporter,
+		ProgressInterval:         progressCfg.interval,
+		Metrics:                  writeCfg.Metrics,
+		ReadLimiter:              writeCfg.ReadLimiter,
+	})
+	cleanup(cfg, &write.WriteStats, write.Remove)
+
+	r := newReport(start, &write.WriteStats, &read.ReadStats)
+	r.Mode = "intervals"
+	r.Unique = read.CoveredCount
+	// covered addresses are counted across all inputs only
+	for i := range r.Inputs {
+		r.Inputs[i].Unique = 0
+	}
+	return r
+}
+
+// creates destination folder and checks that it is writable and, unless
+// disabled by -preflight=false, that estimated runs fit into free disk space
+// and open files limit. Returns false if any check fails
+func checkPreflight(cfg *pipelineConfig, intervals bool) bool {
+	var plan *components.Plan
+	if cfg.preflight {
+		plan = components.Explain(cfg.write, cfg.parallelReaders, cfg.arrayCacheSize, intervals)
+	}
+	errs := components.Preflight(cfg.write, plan)
+	if len(errs) == 0 {
+		return true
+	}
+	for _, err := range errs {
+		slog.Error("preflight check failed", "err", err)
+	}
+	slog.Error("estimations are upper bounds, pass -preflight=false to count anyway")
+	return false
+}
+
+// removes folder of run by remove, unless -keep-intermediate is set. Folders
+// of failed runs are kept until they are garbage collected by runs gc
+func cleanup(cfg *pipelineConfig, write *components.WriteStats, remove func()) {
+	if cfg.keepIntermediate {
+		write.Keep()
+		slog.Info("intermediate files kept", "run", write.RunID, "dir", write.Dir)
+		return
+	}
+	remove()
+	slog.Info("intermediate files removed", "run", write.RunID, "dir", write.Dir)
+}
+
+// configuration of counting pipeline built from flags
+type pipelineConfig struct {
+	write            *components.WrtieConfigs
+	// count of goroutines merging partitions and count of values read at once
+	// from each run while merging
+	parallelReaders  int
+	arrayCacheSize   int
+	// check estimated disk space and open files before counting
+	preflight        bool
+	// keep runs in DstPath after counting
+	keepIntermediate bool
+}
+
+// registers flags of counting pipeline shared by subcommands. Returned config
+// builds configuration for ip file paths ("-" means standard input, ipFile is
+// used if there are no paths) and must be called after flags are parsed.
+func pipelineFlags(flags *flag.FlagSet) (config func(paths []string) *pipelineConfig) {
+	readers := flags.Int("readers", ipReaderCount, "count of segments of ip files read in parallel")
+	partitions := flags.Int("partitions", partitionCount, "count of ip space partitions processed in parallel")
+	// copy non-seekable input into temporary file before counting
+	spill := flags.Bool("spill", false, "copy stdin/pipe/compressed input into temporary file to read it in parallel")
+	elements := flags.Int("elements", elementsPerStage, "count of values of partition kept in btrees before flushing them into run")
+	degree := flags.Int("btree-degree", btreeDegree, "degree of btrees")
+	pageSize := flags.Int("page-size", ipReaderPageSize, "min size of single read of ip files")
+	readerCache := flags.Int("reader-cache", ipReaderCacheSize, "max count of parsed ips waiting to be inserted into btrees of partition")
+	sampleSize := flags.Int("sample-size", partitionSampleSize, "count of ips sampled to compute partition bounds, 0 splits ip space into equal ranges")
+	arrayReaders := flags.Int("array-readers", parallelArrayReaderCount, "count of partitions merged in parallel")
+	arrayCache := flags.Int("array-cache", arrayIteratorCacheSize, "count of values read at once from each run while merging")
+	dst := flags.String("dst", path.Join(dataFolder, dstFolder), "comma separated destination folders of runs, e.g. on different disks. Metadata of runs and spilled inputs are written into the first one")
+	placement := flags.String("placement", components.PlacementRoundRobin, "placement of runs between destination folders: round-robin (runs of each partition are spread between all folders) or partition (all runs of partition are in one folder)")
+	keep := flags.Bool("keep-intermediate", false, "keep runs in destination folder after counting")
+	preflight := flags.Bool("preflight", true, "check free disk space and open files limit against estimations before counting")
+	maxReadRate := byteSizeFlag(flags, "max-read-rate", "max bytes per second read from inputs and runs, e.g. 100M. 0 means unlimited")
+	maxWriteRate := byteSizeFlag(flags, "max-write-rate", "max bytes per second written into destination folders, e.g. 50M. 0 means unlimited")
+	lowPriority := flags.Bool("low-priority", false, "use idle io priority and don't keep inputs and runs in page cache (linux only)")
+
+	return func(paths []string) *pipelineConfig {
+		pwd := util.Must(os.Getwd())
+		if len(paths) == 0 {
+			paths = []string{path.Join(pwd, dataFolder, ipFile)}
+		}
+		if *placement != components.PlacementRoundRobin && *placement != components.PlacementPartition {
+			usageError(flags, fmt.Errorf("unknown placement %q", *placement))
+		}
+		// counts and sizes used as divisors and slice lengths
+		for _, f := range []struct {
+			name  string
+			value int
+		}{
+			{"readers", *readers},
+			{"partitions", *partitions},
+			{"elements", *elements},
+			{"page-size", *pageSize},
+			{"reader-cache", *readerCache},
+			{"array-readers", *arrayReaders},
+			{"array-cache", *arrayCache},
+		} {
+			if f.value < 1 {
+				usageError(flags, fmt.Errorf("-%s must be at least 1, got %d", f.name, f.value))
+			}
+		}
+		if *degree < 2 {
+			usageError(flags, fmt.Errorf("-btree-degree must be at least 2, got %d", *degree))
+		}
+		if *sampleSize < 0 {
+			usageError(flags, fmt.Errorf("-sample-size must not be negative, got %d", *sampleSize))
+		}
+
+		dstPaths := []string{}
+		for _, p := range strings.Split(*dst, ",") {
+			dstPaths = append(dstPaths, util.Must(filepath.Abs(strings.TrimSpace(p))))
+		}
+
+		// io priority is set for the whole process
+		if *lowPriority {
+			if err := util.LowerIOPriority(); err != nil {
+				slog.Warn("io priority isn't lowered", "err", err)
+			}
+		}
+
+		return &pipelineConfig{
+			write: &components.WrtieConfigs{
+				IPFilePaths:       paths,
+				DstPath:           dstPaths[0],
+				ExtraDstPaths:     dstPaths[1:],
+				Placement:         *placement,
+				Prefix:            prefix,
+				IPReaderCount:     *readers,
+				PartitionCount:    *partitions,
+				ElementsPerStage:  *elements,
+				IPReaderPageSize:  *pageSize,
+				IPReaderCacheSize: *readerCache,
+				BTDegree:          *degree,
+
+				PartitionSampleSize: *sampleSize,
+				SpillInput:          *spill,
+
+				ReadLimiter:  util.NewRateLimiter(uint64(*maxReadRate)),
+				WriteLimiter: util.NewRateLimiter(uint64(*maxWriteRate)),
+				LowPriority:  *lowPriority,
+			},
+			parallelReaders:  min(*arrayReaders, *partitions),
+			arrayCacheSize:   *arrayCache,
+			preflight:        *preflight,
+			keepIntermediate: *keep,
+		}
+	}
+}
+
+// size in bytes with optional K, M, G or T suffix (powers of 1024), e.g. 64M
+// or 64MiB
+type byteSize uint64
+
+func (b *byteSize) String() string {
+	return strconv.FormatUint(uint64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	s = strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(strings.TrimSpace(s)), "B"), "I")
+	multiplier := 1.0
+	if i := strings.IndexAny(s, "KMGT"); i != -1 && i == len(s) - 1 {
+		multiplier = math.Pow(1024, float64(strings.IndexByte("KMGT", s[i]) + 1))
+		s = s[:i]
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 {
+		return fmt.Errorf("invalid size %q", s)
+	}
+	*b = byteSize(v * multiplier)
+	return nil
+}
+
+func byteSizeFlag(flags *flag.FlagSet, name string, usage string) *byteSize {
+	b := byteSize(0)
+	flags.Var(&b, name, usage)
+	return &b
+}
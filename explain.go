@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"ip_addr_counter/components"
+	"ip_addr_counter/pkg/progress"
+)
+
+func printTextPlan(w io.Writer, plan *components.Plan, cfg *pipelineConfig) {
+	write := cfg.write
+	fmt.Fprintln(w, "inputs:")
+	for _, in := range plan.Inputs {
+		if in.Sequential {
+			fmt.Fprintf(w, "  %s - stream, read by single reader\n", in.Name)
+			continue
+		}
+		lines := "unknown lines"
+		if in.Compression == "none" {
+			lines = fmt.Sprintf("~%d lines", in.Lines)
+		}
+		fmt.Fprintf(w, "  %s - %s, %s, %s, %d segments\n", in.Name, progress.Bytes(uint64(in.Size)), in.Compression, lines, len(in.Segments))
+		for i, from := range in.Segments {
+			to := in.Size
+			if i != len(in.Segments) - 1 {
+				to = in.Segments[i + 1]
+			}
+			fmt.Fprintf(w, "    segment %d - [%d, %d)\n", i, from, to)
+		}
+	}
+	if plan.Streams > 0 {
+		fmt.Fprintln(w, "  streams read by single reader -", plan.Streams)
+	}
+
+	fmt.Fprintf(w, "partitions (loads estimated from %d sampled ips):\n", plan.Samples)
+	for i, p := range plan.Partitions {
+		fmt.Fprintf(
+			w, "  %d: %s - ~%d values (%.2f%%), flushes %d, runs %d\n",
+			i, components.RangeString(plan.Partitioner, i), p.Load,
+			math.Round(10000 * float64(p.Load) / float64(max(plan.Lines, 1))) / 100, p.Flushes, p.Runs,
+		)
+	}
+
+	if plan.Partial {
+		fmt.Fprintln(w, "sizes of some inputs are unknown, estimations below don't include them")
+	}
+	fmt.Fprintln(w, "estimated lines -", plan.Lines)
+	fmt.Fprintf(w, "stages - %d values per partition stage, up to %d btrees per stage\n", write.ElementsPerStage, plan.BTrees)
+	fmt.Fprintf(w, "flushes - at most %d, runs (files) - at most %d, open at once - at most %d\n", plan.Flushes, plan.Runs, plan.OpenRuns)
+	fmt.Fprintf(w, "disk space - at most %s\n", progress.Bytes(plan.RunBytes))
+	for i, dst := range append([]string{write.DstPath}, write.ExtraDstPaths...) {
+		fmt.Fprintf(w, "  %s - at most %s\n", dst, progress.Bytes(plan.DstBytes[i]))
+	}
+
+	mem := plan.WriteMemory
+	fmt.Fprintf(
+		w, "write phase memory - ~%s (stages %s, arrays %s, pages %s, batches %s)\n",
+		progress.Bytes(mem.Total), progress.Bytes(mem.Stages), progress.Bytes(mem.Arrays),
+		progress.Bytes(mem.Pages), progress.Bytes(mem.Batches),
+	)
+	fmt.Fprintf(w, "read phase memory - ~%s (%d partitions merged in parallel)\n", progress.Bytes(plan.ReadMemory), cfg.parallelReaders)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip_addr_counter/components"
+)
+
+// runs count with args and returns its exit code and stdout
+func runCount(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = out
+	code := count(append([]string{"-log-level", "warn", "-progress", "none"}, args...))
+	os.Stdout = stdout
+	out.Close()
+
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code, string(data)
+}
+
+// -explain prints plan of inputs, partitions and estimations and writes
+// nothing into destination folders
+func TestExplain(t *testing.T) {
+	lines := &strings.Builder{}
+	for i := range 10_000 {
+		fmt.Fprintf(lines, "10.%d.%d.%d\n", i >> 16 & 0xff, i >> 8 & 0xff, i & 0xff)
+	}
+	input := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(input, []byte(lines.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, extra := t.TempDir(), t.TempDir()
+	flags := []string{
+		"-explain", "-readers", "4", "-partitions", "3", "-elements", "1000", "-spill",
+		"-dst", dst + "," + extra, input,
+	}
+	code, out := runCount(t, flags...)
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	for _, expected := range []string{
+		"inputs:\n  " + input + " - ", "4 segments", "    segment 3 - [",
+		"partitions (loads estimated from ", "\n  2: ",
+		"estimated lines - 10000\n", "disk space - at most ", "  " + extra + " - at most ",
+		"write phase memory - ",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("plan doesn't contain %q:\n%s", expected, out)
+		}
+	}
+
+	code, out = runCount(t, append([]string{"-report", "json"}, flags...)...)
+	plan := &components.Plan{}
+	if err := json.Unmarshal([]byte(out), plan); code != 0 || err != nil {
+		t.Fatalf("exit code %d, json plan: %v", code, err)
+	}
+	if len(plan.Inputs) != 1 || len(plan.Inputs[0].Segments) != 4 || len(plan.Partitions) != 3 || plan.Lines != 10_000 {
+		t.Errorf("plan %+v", plan)
+	}
+
+	for _, dir := range []string{dst, extra} {
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Errorf("explain wrote %v into %s", entries, dir)
+		}
+	}
+}
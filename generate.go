@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"time"
+
+	"ip_addr_counter/pkg/ip"
+	"ip_addr_counter/pkg/util"
+)
+
+// suffix of ground truth file written next to generated file
+const truthSuffix = ".truth.json"
+
+// generates file of ips with given distribution and writes its ground truth
+// (count of lines and unique ips) into sidecar file
+func generate(args []string) int {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s generate [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	out := flags.String("o", path.Join(dataFolder, ipFile), "path of generated file, ground truth is written into <path>" + truthSuffix)
+	seed := flags.Uint64("seed", 1, "seed of generator, the same seed and flags give the same file")
+	distribution := flags.String("distribution", ip.Uniform, "distribution of ips: uniform, zipf, clustered or unique (exactly -unique ips repeated -dup times)")
+	lines := flags.Uint64("lines", 1_000_000, "count of lines, ignored by unique distribution")
+	unique := flags.Uint64("unique", 0, "count of distinct ips drawn by uniform and zipf distributions (0 means whole ip space) or exact unique count")
+	dup := flags.Float64("dup", 2, "duplication factor of unique distribution, count of lines is unique * dup")
+	zipfS := flags.Float64("zipf-s", 1.1, "exponent of zipf distribution, greater than 1")
+	clusters := flags.Uint64("clusters", 64, "count of subnets of clustered distribution")
+	clusterBits := flags.Int("cluster-bits", 16, "count of host bits of clustered subnets, e.g. 8 for /24 subnets")
+	errorRate := flags.Float64("error-rate", 0, "fraction of messy lines (CRLF, blank lines, BOMs, wrapped or invalid ips)")
+	workers := flags.Int("workers", runtime.NumCPU(), "count of goroutines generating lines, output doesn't depend on it")
+	messy := flags.String("messy", "", "comma separated kinds of messy lines, all kinds by default: " + messyKindNames())
+	setupLog := logFlags(flags)
+	flags.Parse(args)
+	setupLog()
+
+	cfg := ip.GeneratorConfig{
+		Seed:         *seed,
+		Distribution: *distribution,
+		Lines:        *lines,
+		Unique:       *unique,
+		Duplication:  *dup,
+		ZipfS:        *zipfS,
+		Clusters:     *clusters,
+		ClusterBits:  *clusterBits,
+		ErrorRate:    *errorRate,
+		Workers:      *workers,
+	}
+	if *messy != "" {
+		cfg.MessyKinds = strings.Split(*messy, ",")
+	}
+
+	start := time.Now()
+	f := util.Must(os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644))
+	result := ip.Generate(f, cfg)
+	util.PanicIfErr(f.Close())
+
+	writeTruth(*out + truthSuffix, result)
+	slog.Info(
+		"generated", "file", *out, "distribution", result.Distribution, "lines", result.Lines,
+		"invalid", result.Invalid, "unique", result.Unique, "bytes", result.Bytes, "elapsed", time.Since(start),
+	)
+	return 0
+}
+
+func messyKindNames() string {
+	names := []string{}
+	for _, kind := range ip.MessyKinds {
+		names = append(names, kind.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func writeTruth(path string, result *ip.GeneratorResult) {
+	data := util.Must(json.MarshalIndent(result, "", "  "))
+	util.PanicIfErr(os.WriteFile(path, append(data, '\n'), 0644))
+}
+
+// reads ground truth written by generate
+func readTruth(path string) *ip.GeneratorResult {
+	result := &ip.GeneratorResult{}
+	util.PanicIfErr(json.Unmarshal(util.Must(os.ReadFile(path)), result))
+	return result
+}
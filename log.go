@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"ip_addr_counter/pkg/progress"
+)
+
+// stderr shared by logs and progress bar, so log records don't mix with bar
+// line
+var stderr = progress.NewTerminal(os.Stderr)
+
+// registers logging flags of subcommand. Returned setup configures default
+// logger writing into stderr (through progress bar terminal) and must be
+// called after flags are parsed.
+func logFlags(flags *flag.FlagSet) (setup func()) {
+	format := flags.String("log-format", "text", "format of logs printed into stderr: text or json")
+	level := flags.String("log-level", "info", "min level of logs: debug, info, warn or error")
+
+	return func() {
+		opts := &slog.HandlerOptions{}
+		lvl := slog.LevelInfo
+		if err := lvl.UnmarshalText([]byte(*level)); err != nil {
+			usageError(flags, err)
+		}
+		opts.Level = lvl
+
+		switch *format {
+		case "text":
+			slog.SetDefault(slog.New(slog.NewTextHandler(stderr, opts)))
+		case "json":
+			slog.SetDefault(slog.New(slog.NewJSONHandler(stderr, opts)))
+		default:
+			usageError(flags, fmt.Errorf("unknown log format %q", *format))
+		}
+	}
+}
+
+// prints error and usage of subcommand and exits
+func usageError(flags *flag.FlagSet, err error) {
+	fmt.Fprintln(flags.Output(), err)
+	flags.Usage()
+	os.Exit(2)
+}
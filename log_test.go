@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip_addr_counter/pkg/progress"
+)
+
+// with -log-format json every line of stderr is log record with level and
+// attributes, stdout holds result only
+func TestJSONLogs(t *testing.T) {
+	lines := &strings.Builder{}
+	for i := range 5000 {
+		fmt.Fprintf(lines, "10.0.%d.%d\n", i >> 8, i & 0xff)
+	}
+	input := filepath.Join(t.TempDir(), "ips.txt")
+	if err := os.WriteFile(input, []byte(lines.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	logs := &bytes.Buffer{}
+	terminal, logger := stderr, slog.Default()
+	stderr = progress.NewTerminal(logs)
+	defer func() {
+		stderr = terminal
+		slog.SetDefault(logger)
+	}()
+
+	code, out := runCount(t, "-log-format", "json", "-log-level", "info", "-partitions", "2", "-elements", "1000", "-dst", t.TempDir(), input)
+	if code != 0 {
+		t.Fatalf("exit code %d", code)
+	}
+	if !strings.HasPrefix(out, "uniqCount - 5000\nduration - ") || strings.Count(out, "\n") != 2 {
+		t.Errorf("stdout isn't result only:\n%s", out)
+	}
+
+	messages := map[string]map[string]any{}
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		record := map[string]any{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("log line %q isn't json: %v", line, err)
+		}
+		if record["level"] == nil || record["msg"] == nil {
+			t.Errorf("log record %q without level or message", line)
+		}
+		messages[fmt.Sprint(record["msg"])] = record
+	}
+	for msg, attrs := range map[string][]string{
+		"flushing stage":      {"partition", "stage", "values", "elapsed"},
+		"flushing last stage": {"partition", "stage", "values", "elapsed"},
+		"partition load":      {"partition", "range", "load"},
+	} {
+		record, ok := messages[msg]
+		if !ok {
+			t.Errorf("no %q record in logs:\n%s", msg, logs)
+			continue
+		}
+		for _, attr := range attrs {
+			if _, ok := record[attr]; !ok {
+				t.Errorf("%q record without %q attribute: %v", msg, attr, record)
+			}
+		}
+	}
+}
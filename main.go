@@ -1,19 +1,15 @@
 package main
 
 import (
-	"fmt"
 	"os"
-	"path"
-	"time"
 
-	"ip_addr_counter/components"
 	"ip_addr_counter/pkg/util"
 )
 
 // folder where file with ip addresses. is located
 const dataFolder = "data"
 
-// name of the file with ips.
+// name of the file with ips. Used if input paths are not passed as arguments.
 const ipFile = "ip_addresses.txt"
 
 // folder where intermediate files will be placed.
@@ -22,9 +18,14 @@ const dstFolder = "dst";
 // prefix for intermediate files created while counting.
 const prefix = "array"
 
-// parallel ip readers count. Each reader processes its own array files.
-// readers are distributed linearly between ipFile.
-const ipIteratorCount = 20
+// parallel ip readers count. Readers are distributed linearly between ipFile.
+// Can be overridden by -readers flag.
+const ipReaderCount = 20
+
+// count of ip space partitions. Each partition is processed by its own
+// goroutine into its own array files, independently from readers count.
+// Can be overridden by -partitions flag.
+const partitionCount = 20
 
 // count of elements to read for each iterator before processing to next stage.
 const elementsPerStage = 10_000_000
@@ -33,50 +34,50 @@ const elementsPerStage = 10_000_000
 const ipReaderPageSize = 4 * 1024 * 1024 // 4MB
 
 // max count of ip addresses to store in memory while reading ipFile.
-const ipReaderCacheSize = 1024
+// Addresses are passed in batches of util.BatchSize, so it is rounded down
+// to batch size.
+const ipReaderCacheSize = 64 * 1024
 
 // degree of intermediate btrees.
 // More degree - more memory saving but slower insertion.
 const btreeDegree = 20
 
+// count of ips sampled from ipFile to compute partition bounds, so each
+// partition receives roughly equal part of ips even for skewed inputs.
+// Zero means ip space is split into equal ranges.
+const partitionSampleSize = 64 * 1024
+
 // count of goroutines reading final array files.
-// Must be less or equal to ipIteratorCount
+// Must be less or equal to partitionCount
 const parallelArrayReaderCount = 20
 
 // count of ips for single read operation when iterating through array
 const arrayIteratorCacheSize = 1024 * 1024
 
+// subcommands selected by first argument. Arguments not starting with
+// subcommand name are passed to count for compatibility. Subcommands return
+// exit code instead of exiting, so their deferred calls (e.g. writing
+// profiles) run before exit.
+var commands = map[string]func(args []string) int{
+	"count":    count,
+	"verify":   verify,
+	"generate": generate,
+	"bench":    bench,
+	"runs":     runs,
+}
+
 func main() {
-	start := time.Now()
-	pwd := util.Must(os.Getwd())
-
-	fmt.Println("============ WRITING PHASE ============")
-	arrayListPerStage := components.Write(&components.WrtieConfigs{
-		IPFilePath:        path.Join(pwd, dataFolder, ipFile),
-		DstPath:           path.Join(pwd, dataFolder, dstFolder),
-		Prefix:            prefix,
-		IPIteratorCount:   ipIteratorCount,
-		ElementsPerStage:  elementsPerStage,
-		IPReaderPageSize:  ipReaderPageSize,
-		IPReaderCacheSize: ipReaderCacheSize,
-		BTDegree:          btreeDegree,
-	})
-
-	for i, arrList := range arrayListPerStage {
-		for j, a := range arrList {
-			fmt.Printf("(%v,%v,%v),", i, j, a.Len())
+	// errors are reported by panics, logging them instead of printing stack
+	// trace unless debug logs are enabled
+	defer util.ExitOnPanic()
+
+	command, args := count, os.Args[1:]
+	if len(args) > 0 {
+		if c, ok := commands[args[0]]; ok {
+			command, args = c, args[1:]
 		}
-		fmt.Println()
 	}
-
-	fmt.Println("============ READING PHASE ============")
-	uniqCount := components.Read(&components.ReadConfigs{
-		ArrayListPerStage:        arrayListPerStage,
-		ParallelArrayReaderCount: parallelArrayReaderCount,
-		ArrayIteratorCacheSize:   arrayIteratorCacheSize,
-	})
-
-	fmt.Println()
-	fmt.Println("uniqCount -", uniqCount)
-	fmt.Println("duration -", time.Since(start))
+	if code := command(args); code != 0 {
+		os.Exit(code)
+	}
 }
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+
+	"ip_addr_counter/components"
+	"ip_addr_counter/pkg/metrics"
+	"ip_addr_counter/pkg/util"
+)
+
+// starts http server exposing metrics of counting in Prometheus text format
+// at /metrics. Server is running until process exits
+func serveMetrics(addr string) *components.Metrics {
+	registry := metrics.NewRegistry()
+	m := components.NewMetrics(registry)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry.Handler())
+
+	ln := util.Must(net.Listen("tcp", addr))
+	slog.Info("serving metrics", "addr", ln.Addr().String())
+	go func() {
+		util.PanicIfErr(http.Serve(ln, mux))
+	}()
+	return m
+}
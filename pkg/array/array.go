@@ -81,6 +81,16 @@ func (a *Array) File() file.Interface {
 	return a.file
 }
 
+// closes file of array, it is reopened on next access
+func (a *Array) Close() error {
+	return a.file.Close()
+}
+
+// closes and deletes file of array
+func (a *Array) Remove() error {
+	return a.file.Remove()
+}
+
 func (a *Array) FileReader() io.Reader {
 	return a.file.LimitReader(int64(a.elemSize*a.length))
 }
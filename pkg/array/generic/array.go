@@ -1,6 +1,7 @@
 package array
 
 import (
+	"bufio"
 	"context"
 	"io"
 	"iter"
@@ -11,6 +12,9 @@ import (
 	"ip_addr_counter/pkg/util"
 )
 
+// count of read batches waiting to be consumed by iterator
+const batchQueueSize = 4
+
 type Array[T any] struct {
 	arr *array.Array
 }
@@ -44,31 +48,51 @@ func (a *Array[T]) File() file.Interface {
 	return a.arr.File()
 }
 
+// closes file of array, it is reopened on next access
+func (a *Array[T]) Close() error {
+	return a.arr.Close()
+}
+
+// closes and deletes file of array
+func (a *Array[T]) Remove() error {
+	return a.arr.Remove()
+}
+
 func (a *Array[T]) FileReader() io.Reader {
 	return a.arr.FileReader()
 }
 
-func (a *Array[T]) Iterator(cacheSize int) iter.Seq[T] {
+// returns max count of values held in memory by iterator with given cache
+// size: read buffer and batches queued, being filled and being consumed
+func IteratorBufferedValues(cacheSize int) int {
+	return cacheSize + (batchQueueSize + 2) * util.BatchSize
+}
+
+// returns iterator of array values read by background goroutine. Reads are
+// limited by limiter, nil means unlimited
+func (a *Array[T]) Iterator(cacheSize int, limiter *util.RateLimiter) iter.Seq[T] {
 	ctx, cancel := context.WithCancel(context.Background())
-	ch := make(chan T, cacheSize)
+	pool := util.NewBatchPool[T](util.BatchSize)
+	ch := make(chan []T, batchQueueSize)
 	go func() {
-		L: for itm := range a.arr.Iterator(cacheSize) {
+		defer close(ch)
+		var t T
+		file := bufio.NewReaderSize(util.RateLimitedReader(a.FileReader(), limiter), int(unsafe.Sizeof(t)) * cacheSize)
+
+		// reading elements directly into batches
+		for left := a.Len(); left > 0; {
+			batch := pool.Get()
+			batch = batch[:min(uint64(cap(batch)), left)]
+			util.Must(io.ReadFull(file, util.SliceToBytes(batch)))
+			left -= uint64(len(batch))
+
 			select {
 			case <-ctx.Done():
-				break L
-			case ch <- *util.BytesTo[*T](itm):
-				break
+				return
+			case ch <- batch:
 			}
 		}
-		close(ch)
 	}()
 
-	return func(yield func(T) bool) {
-		for itm := range ch {
-			if !yield(itm) {
-				cancel()
-				break
-			}
-		}
-	}
+	return util.Unbatch(ch, pool, cancel)
 }
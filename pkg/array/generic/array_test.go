@@ -0,0 +1,70 @@
+package array
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"ip_addr_counter/pkg/file"
+	"ip_addr_counter/pkg/util"
+)
+
+// returns in-memory array of count consecutive values
+func testArray(count int) *Array[uint32] {
+	vf := file.Virtual()
+	util.PanicIfErr(vf.Truncate(uint64(count) * 4))
+	a := New[uint32](vf, uint64(count))
+	for i := range uint32(count) {
+		a.Set(uint64(i), &i)
+	}
+	return a
+}
+
+func TestIterator(t *testing.T) {
+	// last batch is partially filled
+	count := 3 * util.BatchSize + 5
+	expected := uint32(0)
+	for v := range testArray(count).Iterator(1000, nil) {
+		if v != expected {
+			t.Fatalf("value %d, expected %d", v, expected)
+		}
+		expected++
+	}
+	if expected != uint32(count) {
+		t.Errorf("%d values, expected %d", expected, count)
+	}
+}
+
+// stopped iteration must stop reading goroutine blocked on full queue
+func TestIteratorCancel(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	a := testArray((batchQueueSize + 4) * util.BatchSize)
+	for range 10 {
+		for v := range a.Iterator(1000, nil) {
+			if v == util.BatchSize + 1 {
+				break
+			}
+		}
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > goroutines {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left after cancelled iterations, expected %d", runtime.NumGoroutine(), goroutines)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func BenchmarkIterator(b *testing.B) {
+	a := testArray(4 * 1024 * 1024)
+	b.SetBytes(int64(a.Len()) * 4)
+	b.ResetTimer()
+	for range b.N {
+		sum := uint32(0)
+		for v := range a.Iterator(1024 * 1024, nil) {
+			sum += v
+		}
+		_ = sum
+	}
+}
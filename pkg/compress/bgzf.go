@@ -0,0 +1,99 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+
+	"ip_addr_counter/pkg/util"
+)
+
+// max size of single compressed BGZF block
+const maxBlockSize = 64 * 1024
+
+// checks that header is gzip member header with "BC" extra subfield
+// holding size of block
+func isBGZFHeader(h []byte) bool {
+	return len(h) >= HeaderSize &&
+		h[0] == 0x1f && h[1] == 0x8b && h[2] == 8 && h[3] & 4 != 0 &&
+		binary.LittleEndian.Uint16(h[10:12]) >= 6 &&
+		h[12] == 'B' && h[13] == 'C' && binary.LittleEndian.Uint16(h[14:16]) == 2
+}
+
+// returns total size of block
+func blockSize(h []byte) int64 {
+	return int64(binary.LittleEndian.Uint16(h[16:18])) + 1
+}
+
+// returns offsets of BGZF blocks splitting file into at most count parts of
+// roughly equal compressed size. First offset is always 0.
+func BlockOffsets(r io.ReaderAt, size int64, count int) []int64 {
+	offsets := []int64{0}
+	window := make([]byte, maxBlockSize + HeaderSize)
+
+	for i := 1; i < count; i++ {
+		from := max(size * int64(i) / int64(count), offsets[len(offsets) - 1] + 1)
+		offset, found := findBlock(r, size, from, window)
+		if !found {
+			break
+		}
+		if offset != offsets[len(offsets) - 1] {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets
+}
+
+// returns offset of first block starting at or after from. Since header bytes
+// can occur inside compressed data, block is accepted only if it decompresses
+// with valid checksum and is followed by another block or by the end of file.
+func findBlock(r io.ReaderAt, size, from int64, window []byte) (int64, bool) {
+	n, err := r.ReadAt(window, from)
+	if err != io.EOF {
+		util.PanicIfErr(err)
+	}
+
+	header := make([]byte, HeaderSize)
+	for i := 0; i + HeaderSize <= n; i++ {
+		j := bytes.IndexByte(window[i:n - HeaderSize + 1], 0x1f)
+		if j == -1 {
+			break
+		}
+		i += j
+
+		if !isBGZFHeader(window[i:]) {
+			continue
+		}
+
+		next := from + int64(i) + blockSize(window[i:])
+		if next > size {
+			continue
+		} else if next < size {
+			n, err := r.ReadAt(header, next)
+			if err != io.EOF {
+				util.PanicIfErr(err)
+			}
+			if !isBGZFHeader(header[:n]) {
+				continue
+			}
+		}
+
+		if validBlock(r, from + int64(i), blockSize(window[i:])) {
+			return from + int64(i), true
+		}
+	}
+	return 0, false
+}
+
+// checks that block of given size at offset is complete gzip member, its
+// checksum and size are verified by gzip reader
+func validBlock(r io.ReaderAt, offset, size int64) bool {
+	gz, err := gzip.NewReader(io.NewSectionReader(r, offset, size))
+	if err != nil {
+		return false
+	}
+	gz.Multistream(false)
+	_, err = io.Copy(io.Discard, gz)
+	return err == nil
+}
@@ -0,0 +1,180 @@
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"ip_addr_counter/pkg/ip"
+)
+
+// bgzip's empty block marking the end of file
+var bgzfEOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 0x06, 0, 'B', 'C', 0x02, 0,
+	0x1b, 0, 0x03, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+}
+
+// compresses data into BGZF blocks of blockSize uncompressed bytes, like
+// bgzip does. Returns file and offsets of its blocks
+func bgzf(data []byte, blockSize, level int) ([]byte, []int64) {
+	file, offsets := []byte{}, []int64{}
+	for from := 0; from < len(data); from += blockSize {
+		block := &bytes.Buffer{}
+		w, err := gzip.NewWriterLevel(block, level)
+		if err != nil {
+			panic(err)
+		}
+		// size of block is patched after compression
+		w.Header.Extra = []byte{'B', 'C', 2, 0, 0, 0}
+		w.Header.OS = 0xff
+		w.Write(data[from:min(from + blockSize, len(data))])
+		w.Close()
+
+		b := block.Bytes()
+		binary.LittleEndian.PutUint16(b[16:18], uint16(len(b) - 1))
+		offsets = append(offsets, int64(len(file)))
+		file = append(file, b...)
+	}
+	offsets = append(offsets, int64(len(file)))
+	return append(file, bgzfEOF...), offsets
+}
+
+// lines of ips of various length, so lines span blocks
+func testLines(count int) []byte {
+	data := []byte{}
+	for i := range count {
+		data = fmt.Appendf(data, "%d.%d.%d.%d\n", i % 256, i * 7 % 256, i * 13 % 256, i % 100)
+	}
+	return data
+}
+
+func TestDetect(t *testing.T) {
+	data := testLines(100)
+	file, _ := bgzf(data, 1000, gzip.DefaultCompression)
+	plain := &bytes.Buffer{}
+	w := gzip.NewWriter(plain)
+	w.Write(data)
+	w.Close()
+
+	tests := []struct {
+		name   string
+		header []byte
+		format Format
+	}{
+		{"bgzf", file, BGZF},
+		{"gzip", plain.Bytes(), Gzip},
+		{"bzip2", []byte("BZh91AY&SY"), Bzip2},
+		{"plain", data, None},
+		{"empty", nil, None},
+		{"short gzip", []byte{0x1f, 0x8b}, None},
+	}
+	for _, tt := range tests {
+		if format := Detect(tt.header[:min(len(tt.header), HeaderSize)]); format != tt.format {
+			t.Errorf("%s: detected %s, expected %s", tt.name, format, tt.format)
+		}
+	}
+}
+
+func TestBlockOffsets(t *testing.T) {
+	data := testLines(20_000)
+	for _, level := range []int{gzip.NoCompression, gzip.DefaultCompression} {
+		file, blocks := bgzf(data, 4096, level)
+		r := bytes.NewReader(file)
+		for count := 1; count <= 40; count++ {
+			offsets := BlockOffsets(r, int64(len(file)), count)
+			if offsets[0] != 0 || len(offsets) > count || !slices.IsSorted(offsets) {
+				t.Fatalf("level %d, %d segments: offsets %v", level, count, offsets)
+			}
+			for _, offset := range offsets {
+				if _, found := slices.BinarySearch(blocks, offset); !found {
+					t.Fatalf("level %d, %d segments: offset %d isn't block start", level, count, offset)
+				}
+			}
+		}
+	}
+}
+
+// header bytes inside compressed data must not be taken for block start.
+// Stored blocks keep data as is, so data holds fake headers
+func TestBlockOffsetsFakeHeader(t *testing.T) {
+	fake := slices.Clone(bgzfEOF[:HeaderSize])
+	binary.LittleEndian.PutUint16(fake[16:18], 100)
+	data := []byte{}
+	for i := range 2000 {
+		data = fmt.Appendf(data, "%d.%d.%d.%d\n", i % 256, 1, 2, 3)
+		if i % 10 == 0 {
+			// first fake block is followed by another fake header
+			data = append(data, fake...)
+			data = append(data, bytes.Repeat([]byte{'\n'}, 101 - HeaderSize)...)
+			data = append(data, fake...)
+		}
+	}
+
+	file, blocks := bgzf(data, 1000, gzip.NoCompression)
+	if !bytes.Contains(file[1:], fake[:4]) {
+		t.Fatal("compressed data doesn't hold fake headers")
+	}
+	r := bytes.NewReader(file)
+	for count := 2; count <= 50; count++ {
+		for _, offset := range BlockOffsets(r, int64(len(file)), count) {
+			if _, found := slices.BinarySearch(blocks, offset); !found {
+				t.Fatalf("%d segments: offset %d isn't block start", count, offset)
+			}
+		}
+	}
+}
+
+// segments start at the beginnings of lines, lines spanning blocks are read
+// by one segment only
+func TestBlockSegments(t *testing.T) {
+	data := testLines(20_000)
+	// the last line without line end
+	data = append(data, "1.2.3.4"...)
+	file, _ := bgzf(data, 1000, gzip.DefaultCompression)
+	r := bytes.NewReader(file)
+	open := func(from, to int64) io.Reader {
+		return NewReader(BGZF, io.NewSectionReader(r, from, to - from))
+	}
+
+	for count := 1; count <= 64; count++ {
+		offsets := BlockOffsets(r, int64(len(file)), count)
+		all := []byte{}
+		for i, s := range ip.BlockSegments(offsets, int64(len(file)), open) {
+			segment, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(segment) > 0 && len(all) > 0 && all[len(all) - 1] != '\n' {
+				t.Fatalf("%d segments: segment %d starts inside line", count, i)
+			}
+			all = append(all, segment...)
+		}
+		if !bytes.Equal(all, data) {
+			t.Fatalf("%d segments: %d bytes read, expected %d", count, len(all), len(data))
+		}
+	}
+}
+
+// members of plain multi-member gzip file are read as single stream
+func TestMultiMemberGzip(t *testing.T) {
+	data := testLines(1000)
+	file := &bytes.Buffer{}
+	for _, part := range [][]byte{data[:1234], data[1234:5000], data[5000:]} {
+		w := gzip.NewWriter(file)
+		w.Write(part)
+		w.Close()
+	}
+
+	stream, format := DecompressStream(bytes.NewReader(file.Bytes()))
+	if format != Gzip {
+		t.Fatalf("detected %s, expected gzip", format)
+	}
+	read, err := io.ReadAll(stream)
+	if err != nil || !bytes.Equal(read, data) {
+		t.Errorf("%d bytes read, %v, expected %d", len(read), err, len(data))
+	}
+}
@@ -0,0 +1,77 @@
+package compress
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+
+	"ip_addr_counter/pkg/util"
+)
+
+type Format int
+
+const (
+	None Format = iota
+	// plain gzip, including multi-member files. Member sizes aren't stored,
+	// so members can't be found without decompressing previous ones and file
+	// is decompressed by single reader
+	Gzip
+	// gzip file consisting of independent blocks with sizes stored in headers
+	// (BGZF, produced by bgzip). Can be decompressed by segments in parallel
+	BGZF
+	Bzip2
+)
+
+// count of first bytes enough to detect format
+const HeaderSize = 18
+
+func (f Format) String() string {
+	switch f {
+	case Gzip:
+		return "gzip"
+	case BGZF:
+		return "bgzf"
+	case Bzip2:
+		return "bzip2"
+	}
+	return "none"
+}
+
+// detects compression format by magic bytes at the beginning of data
+func Detect(header []byte) Format {
+	if len(header) >= 3 && header[0] == 0x1f && header[1] == 0x8b && header[2] == 8 {
+		if isBGZFHeader(header) {
+			return BGZF
+		}
+		return Gzip
+	}
+	if len(header) >= 4 && string(header[:3]) == "BZh" && header[3] >= '1' && header[3] <= '9' {
+		return Bzip2
+	}
+	return None
+}
+
+// returns reader decompressing r. Multi-member gzip files are decompressed
+// as single stream.
+func NewReader(format Format, r io.Reader) io.Reader {
+	switch format {
+	case Gzip, BGZF:
+		return util.Must(gzip.NewReader(r))
+	case Bzip2:
+		return bzip2.NewReader(r)
+	}
+	return r
+}
+
+// detects format of stream by its first bytes and returns decompressed stream
+func DecompressStream(r io.Reader) (io.Reader, Format) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(HeaderSize)
+	if err != io.EOF {
+		util.PanicIfErr(err)
+	}
+
+	format := Detect(header)
+	return NewReader(format, br), format
+}
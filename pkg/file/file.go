@@ -7,4 +7,9 @@ type Interface interface {
 	Slice(from, n uint64) []byte
 	Size() uint64
 	LimitReader(n int64) io.Reader
+	// releases resources held by file. Closed file may be used again, it is
+	// reopened if needed
+	Close() error
+	// closes file and deletes its data
+	Remove() error
 }
@@ -6,25 +6,54 @@ import (
 )
 
 type OSFile struct {
+	path string
+	// nil while file is closed
 	file *os.File
 }
 
 func OS(f *os.File) *OSFile {
-	return &OSFile{f}
+	return &OSFile{f.Name(), f}
+}
+
+// returns closed file at path. It is opened on first read, so files which are
+// not being read don't hold file descriptors
+func OSPath(path string) *OSFile {
+	return &OSFile{path: path}
+}
+
+func (of *OSFile) Path() string {
+	return of.path
+}
+
+func (of *OSFile) open() *os.File {
+	if of.file == nil {
+		f, err := os.OpenFile(of.path, os.O_RDWR, os.ModePerm)
+		if err != nil {
+			panic(err)
+		}
+		of.file = f
+	}
+	return of.file
 }
 
 func (of *OSFile) Truncate(size uint64) error {
-	return of.file.Truncate(int64(size))
+	return of.open().Truncate(int64(size))
 }
 
 func (of *OSFile) Slice(from, n uint64) []byte {
 	buf := make([]byte, n)
-	of.file.ReadAt(buf, int64(from))
+	of.open().ReadAt(buf, int64(from))
 	return buf
 }
 
 func (of *OSFile) Size() uint64 {
-	stat, err := of.file.Stat()
+	var stat os.FileInfo
+	var err error
+	if of.file != nil {
+		stat, err = of.file.Stat()
+	} else {
+		stat, err = os.Stat(of.path)
+	}
 	if err != nil {
 		panic(err)
 	}
@@ -32,6 +61,23 @@ func (of *OSFile) Size() uint64 {
 }
 
 func (of *OSFile) LimitReader(n int64) io.Reader {
-	of.file.Seek(0, io.SeekStart)
-	return io.LimitReader(of.file, int64(n))
+	f := of.open()
+	f.Seek(0, io.SeekStart)
+	return io.LimitReader(f, int64(n))
+}
+
+func (of *OSFile) Close() error {
+	if of.file == nil {
+		return nil
+	}
+	err := of.file.Close()
+	of.file = nil
+	return err
+}
+
+func (of *OSFile) Remove() error {
+	if err := of.Close(); err != nil {
+		return err
+	}
+	return os.Remove(of.path)
 }
@@ -37,3 +37,13 @@ func (vf *VirtualFile) Slice(from, n uint64) []byte {
 func (vf *VirtualFile) LimitReader(n int64) io.Reader {
 	return bytes.NewReader(vf.data[:n])
 }
+
+func (vf *VirtualFile) Close() error {
+	return nil
+}
+
+// releases data of file
+func (vf *VirtualFile) Remove() error {
+	vf.data = nil
+	return nil
+}
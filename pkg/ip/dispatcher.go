@@ -0,0 +1,121 @@
+package ip
+
+import (
+	"context"
+	"iter"
+	"sync/atomic"
+
+	"ip_addr_counter/pkg/util"
+)
+
+// values of single input routed into single partition
+type batch[T any] struct {
+	source int
+	values []T
+}
+
+// collects values of single reader into per partition batches and sends
+// filled ones into partition channels
+type dispatcher[T any] struct {
+	ctx         context.Context
+	chArr       []chan batch[T]
+	pool        *util.BatchPool[T]
+	partitioner *Partitioner
+	batches     [][]T
+	// input of currently read segment
+	source      int
+	// count of lines and invalid lines parsed since last updateStats
+	lines       uint64
+	invalid     uint64
+}
+
+func newDispatcher[T any](
+	ctx context.Context,
+	chArr []chan batch[T],
+	pool *util.BatchPool[T],
+	partitioner *Partitioner,
+) *dispatcher[T] {
+	batches := make([][]T, len(chArr))
+	for i := range batches {
+		batches[i] = pool.Get()
+	}
+	return &dispatcher[T]{
+		ctx:         ctx,
+		chArr:       chArr,
+		pool:        pool,
+		partitioner: partitioner,
+		batches:     batches,
+	}
+}
+
+// switches dispatcher to segment of another input. Batches of previous input
+// are sent, since batch holds values of single input only.
+func (d *dispatcher[T]) setSource(source int) bool {
+	if source == d.source {
+		return true
+	}
+
+	ok := d.flush()
+	d.source = source
+	return ok
+}
+
+// appends value into batch of index'th partition. Returns false if reading
+// was cancelled.
+func (d *dispatcher[T]) push(index int, v T) bool {
+	d.batches[index] = append(d.batches[index], v)
+	if len(d.batches[index]) == cap(d.batches[index]) {
+		return d.send(index)
+	}
+	return true
+}
+
+func (d *dispatcher[T]) send(index int) bool {
+	select {
+	case <-d.ctx.Done():
+		return false
+	case d.chArr[index] <- batch[T]{d.source, d.batches[index]}:
+		d.batches[index] = d.pool.Get()
+		return true
+	}
+}
+
+// sends all non empty batches
+func (d *dispatcher[T]) flush() bool {
+	for i, batch := range d.batches {
+		if len(batch) > 0 && !d.send(i) {
+			return false
+		}
+	}
+	return true
+}
+
+// adds counts of parsed lines into stats
+func (d *dispatcher[T]) updateStats(stats *Stats) {
+	atomic.AddUint64(&stats.Lines, d.lines)
+	atomic.AddUint64(&stats.Invalid, d.invalid)
+	d.lines, d.invalid = 0, 0
+}
+
+// returns empty batches into pool
+func (d *dispatcher[T]) release() {
+	for i := range d.batches {
+		d.pool.Put(d.batches[i])
+		d.batches[i] = nil
+	}
+}
+
+// returns iterator yielding (source, value) pairs of batches received from ch
+func unbatch[T any](ch <-chan batch[T], pool *util.BatchPool[T], cancel func()) iter.Seq2[int, T] {
+	return func(yield func(int, T) bool) {
+		for b := range ch {
+			for _, v := range b.values {
+				if !yield(b.source, v) {
+					cancel()
+					return
+				}
+			}
+			pool.Put(b.values)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package ip
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"ip_addr_counter/pkg/util"
+)
+
+func TestDispatcherBatches(t *testing.T) {
+	pool := util.NewBatchPool[uint32](util.BatchSize)
+	chArr := []chan batch[uint32]{make(chan batch[uint32], 16), make(chan batch[uint32], 16)}
+	partitioner := UniformPartitioner(2)
+	d := newDispatcher(context.Background(), chArr, pool, partitioner)
+
+	values := 3 * util.BatchSize
+	for v := range values {
+		// the second half of values is read from another input
+		if v == values / 2 && !d.setSource(1) {
+			t.Fatal("dispatcher is cancelled")
+		}
+		ip := uint32(v) * 104729 * 4099
+		if !d.push(partitioner.Index(ip), ip) {
+			t.Fatal("dispatcher is cancelled")
+		}
+	}
+	if !d.flush() {
+		t.Fatal("dispatcher is cancelled")
+	}
+	d.release()
+	for _, ch := range chArr {
+		close(ch)
+	}
+
+	count, sources := 0, [2]int{}
+	for i, ch := range chArr {
+		for source, ip := range unbatch(ch, pool, func() { t.Error("iteration is cancelled") }) {
+			if partitioner.Index(ip) != i {
+				t.Fatalf("%s is yielded by partition %d", ToString(ip), i)
+			}
+			count++
+			sources[source]++
+		}
+	}
+	if count != values || sources[0] != values / 2 {
+		t.Errorf("%d values, %d of input 0, expected %d and %d", count, sources[0], values, values / 2)
+	}
+	if pool.Taken() != 0 {
+		t.Errorf("%d batches aren't returned into pool", pool.Taken())
+	}
+}
+
+// returns lines of random ips
+func randomLines(lines int) []byte {
+	rnd := rand.New(rand.NewPCG(3, 4))
+	data := []byte{}
+	for range lines {
+		ip := rnd.Uint32()
+		data = fmt.Appendf(data, "%d.%d.%d.%d\n", ip >> 24, ip >> 16 & 0xff, ip >> 8 & 0xff, ip & 0xff)
+	}
+	return data
+}
+
+// returns jobs of count segments of data
+func segmentJobs(data []byte, count int) []Job {
+	r := bytes.NewReader(data)
+	jobs := []Job{}
+	for _, s := range Segments(r, int64(len(data)), count, MaxIpAddrSize) {
+		jobs = append(jobs, SingleJob(Segment{Reader: s}))
+	}
+	return jobs
+}
+
+// waits until count of goroutines drops to count
+func waitGoroutines(t *testing.T, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > count {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1 << 20)
+			t.Fatalf("%d goroutines left, expected %d:\n%s", runtime.NumGoroutine(), count, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stopping iteration of one partition cancels readers, other partitions end
+// with values already sent to them
+func TestIteratorCancel(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	iterators := Iterator(segmentJobs(randomLines(200_000), 8), 4, 4096, util.BatchSize, UniformPartitioner(4), &Stats{}, nil)
+
+	read := 0
+	for range iterators[0] {
+		read++
+		if read == 10 {
+			break
+		}
+	}
+
+	done := make(chan int)
+	for _, it := range iterators[1:] {
+		go func() {
+			count := 0
+			for range it {
+				count++
+			}
+			done <- count
+		}()
+	}
+	for range iterators[1:] {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("iteration of partitions isn't finished after cancellation")
+		}
+	}
+	waitGoroutines(t, goroutines)
+}
+
+// readers and partitions are consumed concurrently, as by Write
+func BenchmarkIterator(b *testing.B) {
+	data := randomLines(1_000_000)
+	for _, readers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("readers=%d", readers), func(b *testing.B) {
+			b.SetBytes(int64(len(data)))
+			for range b.N {
+				wg := &sync.WaitGroup{}
+				for _, it := range Iterator(segmentJobs(data, readers), readers, 4 * 1024 * 1024, 64 * 1024, UniformPartitioner(4), &Stats{}, nil) {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for range it {
+						}
+					}()
+				}
+				wg.Wait()
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package ip
+
+import (
+	"bytes"
+	"errors"
+)
+
+var ErrInvalidIP = errors.New("invalid ip address")
+
+// parses dotted decimal ipv4 address into uint32 without allocations.
+// Address must consist of exactly 4 octets of 1-3 digits each not greater
+// than 255.
+func ParseUint32(src []byte) (uint32, error) {
+	ip, octet := uint32(0), uint32(0)
+	digits, dots := 0, 0
+
+	for _, c := range src {
+		if c >= '0' && c <= '9' {
+			octet = octet*10 + uint32(c-'0')
+			digits++
+			if digits > 3 || octet > 255 {
+				return 0, ErrInvalidIP
+			}
+		} else if c == '.' && digits != 0 && dots < 3 {
+			ip = ip<<8 | octet
+			octet, digits = 0, 0
+			dots++
+		} else {
+			return 0, ErrInvalidIP
+		}
+	}
+
+	if digits == 0 || dots != 3 {
+		return 0, ErrInvalidIP
+	}
+	return ip<<8 | octet, nil
+}
+
+// parses complete ('\n' terminated) lines from buf into dst until dst is filled
+// or there are no complete lines left. Single '\r' before '\n' is allowed.
+// Returns count of parsed ips and count of consumed bytes. On invalid line
+// parsing stops and consumed points to the beginning of that line.
+func ParseLines(buf []byte, dst []uint32) (n, consumed int, err error) {
+	for n < len(dst) {
+		i := bytes.IndexByte(buf[consumed:], '\n')
+		if i == -1 {
+			break
+		}
+
+		line := buf[consumed : consumed+i]
+		if i > 0 && line[i-1] == '\r' {
+			line = line[:i-1]
+		}
+		if dst[n], err = ParseUint32(line); err != nil {
+			return n, consumed, err
+		}
+		n++
+		consumed += i + 1
+	}
+
+	return n, consumed, nil
+}
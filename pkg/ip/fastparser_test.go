@@ -0,0 +1,207 @@
+package ip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"testing"
+)
+
+func TestParseUint32(t *testing.T) {
+	tests := []struct {
+		src   string
+		ip    uint32
+		valid bool
+	}{
+		{"0.0.0.0", 0, true},
+		{"255.255.255.255", MaxIpAddrValue, true},
+		{"1.2.3.4", 0x01020304, true},
+		{"192.168.0.1", 0xc0a80001, true},
+		// leading zeros are decimal, not octal
+		{"01.02.03.04", 0x01020304, true},
+		{"010.000.001.255", 0x0a0001ff, true},
+		{"0001.2.3.4", 0, false},
+		// octets over 255
+		{"256.0.0.0", 0, false},
+		{"1.2.3.256", 0, false},
+		{"1.2.300.4", 0, false},
+		{"999.1.1.1", 0, false},
+		// count of dots
+		{"1.2.3", 0, false},
+		{"1.2.3.4.5", 0, false},
+		{"1.2.3.4.", 0, false},
+		{".1.2.3.4", 0, false},
+		{"1..2.3", 0, false},
+		{"1234", 0, false},
+		// empty and garbage
+		{"", 0, false},
+		{"...", 0, false},
+		{" 1.2.3.4", 0, false},
+		{"1.2.3.4 ", 0, false},
+		{"1.2.3.4\r", 0, false},
+		{"1.2.3.-4", 0, false},
+		{"a.b.c.d", 0, false},
+		{"::1", 0, false},
+	}
+
+	for _, tt := range tests {
+		ip, err := ParseUint32([]byte(tt.src))
+		if tt.valid && (err != nil || ip != tt.ip) {
+			t.Errorf("ParseUint32(%q) = %#x, %v, expected %#x", tt.src, ip, err, tt.ip)
+		} else if !tt.valid && err == nil {
+			t.Errorf("ParseUint32(%q) = %#x, expected error", tt.src, ip)
+		}
+	}
+}
+
+func TestParseLines(t *testing.T) {
+	tests := []struct {
+		name     string
+		buf      string
+		dst      int
+		ips      []uint32
+		consumed int
+		err      bool
+	}{
+		{"lf", "1.2.3.4\n5.6.7.8\n", 8, []uint32{0x01020304, 0x05060708}, 16, false},
+		{"crlf", "1.2.3.4\r\n5.6.7.8\r\n", 8, []uint32{0x01020304, 0x05060708}, 18, false},
+		// incomplete last line is left for the next page
+		{"incomplete line", "1.2.3.4\n5.6.7", 8, []uint32{0x01020304}, 8, false},
+		{"empty buffer", "", 8, []uint32{}, 0, false},
+		// dst is filled before all lines are parsed
+		{"full dst", "1.2.3.4\n5.6.7.8\n9.9.9.9\n", 2, []uint32{0x01020304, 0x05060708}, 16, false},
+		// parsing stops at invalid line, consumed points to its beginning
+		{"bad line in the middle", "1.2.3.4\n5.6.7.8\n1.2.3\n9.9.9.9\n", 8, []uint32{0x01020304, 0x05060708}, 16, true},
+		{"bad first line", "256.1.1.1\n1.2.3.4\n", 8, []uint32{}, 0, true},
+		{"empty line", "1.2.3.4\n\n5.6.7.8\n", 8, []uint32{0x01020304}, 8, true},
+		{"empty crlf line", "\r\n1.2.3.4\n", 8, []uint32{}, 0, true},
+		{"double cr", "1.2.3.4\r\r\n", 8, []uint32{}, 0, true},
+	}
+
+	for _, tt := range tests {
+		dst := make([]uint32, tt.dst)
+		n, consumed, err := ParseLines([]byte(tt.buf), dst)
+		if (err != nil) != tt.err || consumed != tt.consumed || n != len(tt.ips) || !equalIPs(dst[:n], tt.ips) {
+			t.Errorf(
+				"%s: ParseLines(%q) = %v, consumed %d, err %v, expected %v, consumed %d, error %v",
+				tt.name, tt.buf, dst[:n], consumed, err, tt.ips, tt.consumed, tt.err,
+			)
+		}
+	}
+}
+
+func TestParseAllocs(t *testing.T) {
+	page, _ := benchmarkLines(64)
+	dst := make([]uint32, 16)
+	allocs := testing.AllocsPerRun(100, func() {
+		for buf := page; len(buf) > 0; {
+			_, consumed, _ := ParseLines(buf, dst)
+			buf = buf[consumed:]
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("ParseLines allocates %v times per page", allocs)
+	}
+}
+
+// invalid lines are skipped by resuming after them, as readers do
+func TestParseLinesResume(t *testing.T) {
+	buf := []byte("1.2.3.4\nbad\n5.6.7.8\r\n\n9.9.9.9\n")
+	dst := make([]uint32, 1)
+	ips, invalid := []uint32{}, 0
+	for len(buf) > 0 {
+		n, consumed, err := ParseLines(buf, dst)
+		ips = append(ips, dst[:n]...)
+		buf = buf[consumed:]
+		if err != nil {
+			invalid++
+			buf = buf[bytes.IndexByte(buf, '\n') + 1:]
+		}
+	}
+	if !equalIPs(ips, []uint32{0x01020304, 0x05060708, 0x09090909}) || invalid != 2 {
+		t.Errorf("parsed %v with %d invalid lines", ips, invalid)
+	}
+}
+
+func equalIPs(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// returns page of random ips separated by '\n' and the ips themselves
+func benchmarkLines(count int) ([]byte, [][]byte) {
+	rnd := rand.New(rand.NewPCG(1, 2))
+	page := []byte{}
+	lines := [][]byte{}
+	for range count {
+		ip := rnd.Uint32()
+		line := fmt.Appendf(nil, "%d.%d.%d.%d", ip >> 24, ip >> 16 & 0xff, ip >> 8 & 0xff, ip & 0xff)
+		lines = append(lines, line)
+		page = append(append(page, line...), '\n')
+	}
+	return page, lines
+}
+
+// parser replaced by ParseUint32, the result is decoded the same way readers
+// decoded it before
+func BenchmarkParse(b *testing.B) {
+	page, lines := benchmarkLines(4096)
+	p := Parser()
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	sum := uint32(0)
+	for range b.N {
+		for _, line := range lines {
+			ip, err := p.Parse(line)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sum += binary.BigEndian.Uint32(ip)
+		}
+	}
+	_ = sum
+}
+
+func BenchmarkParseUint32(b *testing.B) {
+	page, lines := benchmarkLines(4096)
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	sum := uint32(0)
+	for range b.N {
+		for _, line := range lines {
+			ip, err := ParseUint32(line)
+			if err != nil {
+				b.Fatal(err)
+			}
+			sum += ip
+		}
+	}
+	_ = sum
+}
+
+func BenchmarkParseLines(b *testing.B) {
+	page, _ := benchmarkLines(4096)
+	dst := make([]uint32, 256)
+	b.SetBytes(int64(len(page)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		for buf := page; len(buf) > 0; {
+			_, consumed, err := ParseLines(buf, dst)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf = buf[consumed:]
+		}
+	}
+}
@@ -1,31 +1,381 @@
 package ip
 
 import (
-	"bufio"
-	"bytes"
+	"fmt"
+	"io"
+	"math"
 	"math/rand/v2"
-	"os"
+	"runtime"
 	"strconv"
+	"sync"
+	"sync/atomic"
 
 	"ip_addr_counter/pkg/util"
 )
 
-func Generate(dstPath string, count int, flags int) {
-	f := util.Must(os.OpenFile(dstPath, os.O_RDWR|flags, os.ModePerm))
-	bf := bufio.NewWriterSize(f, 16*4096)
-	ip := &bytes.Buffer{}
-	for range count {
-		ip.Reset()
-		ip.Write([]byte(strconv.Itoa(rand.Int() % 255)))
-		ip.WriteByte('.')
-		ip.Write([]byte(strconv.Itoa(rand.Int() % 255)))
-		ip.WriteByte('.')
-		ip.Write([]byte(strconv.Itoa(rand.Int() % 255)))
-		ip.WriteByte('.')
-		ip.Write([]byte(strconv.Itoa(rand.Int() % 255)))
-		ip.WriteByte('\n')
-		bf.Write(ip.Bytes())
-	}
-	util.PanicIfErr(bf.Flush())
-	util.PanicIfErr(f.Close())
+// count of lines generated and written at once by single worker
+const generatorChunkLines = 64 * 1024
+
+// distributions of generated ips
+const (
+	// ips drawn uniformly from Unique distinct addresses
+	Uniform   = "uniform"
+	// ips drawn from Unique distinct addresses with Zipf distributed
+	// frequencies, so few addresses are very frequent
+	Zipf      = "zipf"
+	// ips drawn uniformly from Clusters random subnets of 2^ClusterBits addresses
+	Clustered = "clustered"
+	// each of Unique distinct addresses appears Duplication times (rounded)
+	// in random order, so unique count is exactly Unique
+	Exact     = "unique"
+)
+
+type GeneratorConfig struct {
+	// generated lines are fully determined by seed and other fields
+	Seed         uint64
+	Distribution string
+	// count of lines, ignored by Exact distribution
+	Lines        uint64
+	// count of distinct addresses ips are drawn from. Zero means whole ip
+	// space for Uniform and Zipf distributions
+	Unique       uint64
+	// average count of repeats of each address for Exact distribution
+	Duplication  float64
+	// exponent of Zipf distribution, must be greater than 1
+	ZipfS        float64
+	Clusters     uint64
+	ClusterBits  int
+
+	// fraction of lines replaced by messy lines of MessyKinds (CRLF, blank
+	// lines, wrapped ips etc), chosen uniformly. Empty MessyKinds means all kinds
+	ErrorRate    float64
+	MessyKinds   []string
+
+	// count of goroutines generating lines, zero means GOMAXPROCS. Output
+	// doesn't depend on it
+	Workers      int
+}
+
+// ground truth of generated file
+type GeneratorResult struct {
+	Seed         uint64 `json:"seed"`
+	Distribution string `json:"distribution"`
+	Lines        uint64 `json:"lines"`
+	Valid        uint64 `json:"valid"`
+	Invalid      uint64 `json:"invalid"`
+	Unique       uint64 `json:"unique"`
+	Bytes        uint64 `json:"bytes"`
+	// count of messy lines of each kind
+	Messy        map[string]uint64 `json:"messy,omitempty"`
+}
+
+// draws ips of lines. Each line is generated independently from its index and
+// seed, so lines can be generated in any order.
+type Generator struct {
+	cfg        GeneratorConfig
+	lines      uint64
+	// count of distinct addresses ips are drawn from, each address has its
+	// index in [0, universe) mapped to ip by permutation
+	universe   uint64
+	// permutations of ip space and of lines (Exact distribution)
+	ipPerm     *permutation
+	linePerm   *permutation
+	// subnet bases are drawn from permutation of subnets
+	subnetPerm *permutation
+	messyKey   uint64
+	messy      []*MessyKind
+}
+
+func NewGenerator(cfg GeneratorConfig) *Generator {
+	g := &Generator{
+		cfg:       cfg,
+		lines:     cfg.Lines,
+		universe:  cfg.Unique,
+		ipPerm:   newPermutation(MaxIpAddrValue + 1, mix(cfg.Seed, 1)),
+		messyKey: mix(cfg.Seed, 4),
+	}
+
+	if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 {
+		panic(fmt.Errorf("error rate must be in [0, 1], got %v", cfg.ErrorRate))
+	} else if cfg.ErrorRate > 0 {
+		g.messy = messyKinds(cfg.MessyKinds)
+	}
+
+	switch cfg.Distribution {
+	case Uniform:
+		if g.universe == 0 || g.universe > MaxIpAddrValue + 1 {
+			g.universe = MaxIpAddrValue + 1
+		}
+	case Zipf:
+		if g.universe == 0 || g.universe > MaxIpAddrValue + 1 {
+			g.universe = MaxIpAddrValue + 1
+		}
+		if cfg.ZipfS <= 1 {
+			panic(fmt.Errorf("zipf exponent must be greater than 1, got %v", cfg.ZipfS))
+		}
+	case Clustered:
+		if cfg.ClusterBits < 0 || cfg.ClusterBits > 32 {
+			panic(fmt.Errorf("cluster bits must be in [0, 32], got %d", cfg.ClusterBits))
+		}
+		if cfg.Clusters == 0 || cfg.Clusters > 1 << (32 - cfg.ClusterBits) {
+			panic(fmt.Errorf("count of clusters must be in [1, %d], got %d", uint64(1) << (32 - cfg.ClusterBits), cfg.Clusters))
+		}
+		g.universe = cfg.Clusters << cfg.ClusterBits
+		g.subnetPerm = newPermutation(1 << (32 - cfg.ClusterBits), mix(cfg.Seed, 3))
+	case Exact:
+		if g.universe == 0 || g.universe > MaxIpAddrValue + 1 {
+			panic(fmt.Errorf("unique count must be in [1, %d], got %d", uint64(MaxIpAddrValue) + 1, g.universe))
+		}
+		if cfg.Duplication < 1 {
+			panic(fmt.Errorf("duplication factor must be at least 1, got %v", cfg.Duplication))
+		}
+		g.lines = uint64(math.Round(float64(g.universe) * cfg.Duplication))
+		g.linePerm = newPermutation(g.lines, mix(cfg.Seed, 2))
+	default:
+		panic(fmt.Errorf("unknown distribution %q", cfg.Distribution))
+	}
+	return g
+}
+
+// returns count of generated lines
+func (g *Generator) Lines() uint64 {
+	return g.lines
+}
+
+// returns count of distinct addresses ips are drawn from
+func (g *Generator) Universe() uint64 {
+	return g.universe
+}
+
+// draws lines of generator. Samplers are not safe for concurrent use, but
+// each goroutine may use its own one.
+type Sampler struct {
+	g    *Generator
+	src  *lineSource
+	zipf *rand.Zipf
+}
+
+func (g *Generator) Sampler() *Sampler {
+	s := &Sampler{g: g, src: &lineSource{}}
+	if g.cfg.Distribution == Zipf {
+		s.zipf = rand.NewZipf(rand.New(s.src), g.cfg.ZipfS, 1, g.universe - 1)
+	}
+	return s
+}
+
+// returns ip of line and index of ip in [0, Universe())
+func (s *Sampler) IP(line uint64) (ip uint32, index uint64) {
+	g := s.g
+	s.src.state = mix(g.cfg.Seed, line)
+	switch g.cfg.Distribution {
+	case Uniform:
+		index = s.src.Uint64() % g.universe
+	case Zipf:
+		index = s.zipf.Uint64()
+	case Clustered:
+		return g.clusteredIP(s.src.Uint64() % g.universe)
+	case Exact:
+		index = g.linePerm.apply(line) % g.universe
+	}
+	return uint32(g.ipPerm.apply(index)), index
+}
+
+// appends line terminated by '\n' to dst. Returns index of ip of line and
+// kind of line, nil if line is clean ip
+func (s *Sampler) AppendLine(dst []byte, line uint64) ([]byte, uint64, *MessyKind) {
+	ip, index := s.IP(line)
+	g := s.g
+	if g.messy != nil {
+		r := mix(g.messyKey, line)
+		if float64(r >> 11) / (1 << 53) < g.cfg.ErrorRate {
+			r = mix(r, line)
+			kind := g.messy[r % uint64(len(g.messy))]
+			return append(kind.format(dst, ip, r >> 8), '\n'), index, kind
+		}
+	}
+	return append(AppendIP(dst, ip), '\n'), index, nil
+}
+
+// returns ip of index'th address of clusters. Bases of clusters are distinct
+// subnets, hosts are consecutive inside subnet
+func (g *Generator) clusteredIP(index uint64) (uint32, uint64) {
+	bits := g.cfg.ClusterBits
+	cluster, host := index >> bits, index & (1 << bits - 1)
+	subnet := g.subnetPerm.apply(cluster)
+	return uint32(subnet << bits | host), index
+}
+
+// writes generated lines into w and returns ground truth. Lines are generated
+// by cfg.Workers goroutines in chunks of generatorChunkLines, chunks are
+// written in order, so output doesn't depend on count of workers. If w
+// implements io.WriterAt (e.g. *os.File), chunks are written at their offsets
+// in parallel. Indices of ips of valid lines are tracked by bitmap to count
+// unique ips, except Exact distribution without messy lines where unique
+// count is known.
+func Generate(w io.Writer, cfg GeneratorConfig) *GeneratorResult {
+	g := NewGenerator(cfg)
+	var seen util.Bitmap
+	if cfg.Distribution != Exact || g.messy != nil {
+		seen = util.NewBitmap(g.Universe())
+	}
+
+	result := &GeneratorResult{
+		Seed:         cfg.Seed,
+		Distribution: cfg.Distribution,
+		Lines:        g.Lines(),
+		Unique:       g.Universe(),
+	}
+	if g.messy != nil {
+		result.Messy = map[string]uint64{}
+	}
+
+	wa, parallelWrite := w.(io.WriterAt)
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	chunks := (g.Lines() + generatorChunkLines - 1) / generatorChunkLines
+
+	// chunks are claimed by workers in order, offsets are assigned (or chunks
+	// are written) one after another
+	m := &sync.Mutex{}
+	turn := sync.NewCond(m)
+	next, written, offset := uint64(0), uint64(0), int64(0)
+
+	wg := &sync.WaitGroup{}
+	for range min(uint64(workers), chunks) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sampler := g.Sampler()
+			buf := make([]byte, 0, generatorChunkLines * MaxIpAddrSize)
+			valid, messy := uint64(0), map[string]uint64{}
+
+			for {
+				chunk := atomic.AddUint64(&next, 1) - 1
+				if chunk >= chunks {
+					break
+				}
+
+				buf = buf[:0]
+				for line := chunk * generatorChunkLines; line < min((chunk + 1) * generatorChunkLines, g.Lines()); line++ {
+					var index uint64
+					var kind *MessyKind
+					buf, index, kind = sampler.AppendLine(buf, line)
+					if kind != nil {
+						messy[kind.Name]++
+					}
+					if kind == nil || kind.Valid {
+						valid++
+						if seen != nil {
+							seen.Add(index)
+						}
+					}
+				}
+
+				m.Lock()
+				for written != chunk {
+					turn.Wait()
+				}
+				at := offset
+				offset += int64(len(buf))
+				if !parallelWrite {
+					util.Must(w.Write(buf))
+				}
+				written++
+				turn.Broadcast()
+				m.Unlock()
+
+				if parallelWrite {
+					util.Must(wa.WriteAt(buf, at))
+				}
+			}
+
+			m.Lock()
+			defer m.Unlock()
+			result.Valid += valid
+			for name, count := range messy {
+				result.Messy[name] += count
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.Invalid = result.Lines - result.Valid
+	result.Bytes = uint64(offset)
+	if seen != nil {
+		result.Unique = seen.Count()
+	}
+	return result
+}
+
+// appends dotted decimal form of ip to dst without allocations
+func AppendIP(dst []byte, ip uint32) []byte {
+	dst = append(dst, octets[ip >> 24]...)
+	dst = append(dst, '.')
+	dst = append(dst, octets[byte(ip >> 16)]...)
+	dst = append(dst, '.')
+	dst = append(dst, octets[byte(ip >> 8)]...)
+	dst = append(dst, '.')
+	return append(dst, octets[byte(ip)]...)
+}
+
+// decimal forms of octets
+var octets = func() [256]string {
+	var octets [256]string
+	for i := range octets {
+		octets[i] = strconv.Itoa(i)
+	}
+	return octets
+}()
+
+// source of random numbers of single line, see mix
+type lineSource struct {
+	state uint64
+}
+
+func (s *lineSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix(s.state, 0)
+}
+
+// hashes pair of values (splitmix64 finalizer)
+func mix(a, b uint64) uint64 {
+	z := a ^ (b + 0x9e3779b97f4a7c15 + a << 6 + a >> 2)
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// pseudo random permutation of [0, n) given by key. Feistel network permutes
+// smallest power of 4 not less than n, values out of range are permuted again
+// until they are in range (cycle walking).
+type permutation struct {
+	n    uint64
+	key  uint64
+	// bits of each half of permuted values
+	half int
+	mask uint64
+}
+
+func newPermutation(n, key uint64) *permutation {
+	half := 1
+	for uint64(1) << (2 * half) < n {
+		half++
+	}
+	return &permutation{n: n, key: key, half: half, mask: uint64(1) << half - 1}
+}
+
+// returns image of x
+func (p *permutation) apply(x uint64) uint64 {
+	for {
+		l, r := x >> p.half, x & p.mask
+		for round := range uint64(4) {
+			l, r = r, l ^ mix(r, p.key + round) & p.mask
+		}
+		x = l << p.half | r
+		if x < p.n {
+			return x
+		}
+	}
 }
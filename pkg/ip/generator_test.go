@@ -0,0 +1,134 @@
+package ip
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// small configurations of each distribution, generating several chunks
+func testGeneratorConfigs() []GeneratorConfig {
+	lines := uint64(3 * generatorChunkLines + 1000)
+	return []GeneratorConfig{
+		{Seed: 1, Distribution: Uniform, Lines: lines, Unique: 100_000},
+		{Seed: 2, Distribution: Zipf, Lines: lines, Unique: 100_000, ZipfS: 1.1},
+		{Seed: 3, Distribution: Clustered, Lines: lines, Clusters: 16, ClusterBits: 8},
+		{Seed: 4, Distribution: Exact, Unique: 50_000, Duplication: 4},
+		{Seed: 5, Distribution: Uniform, Lines: lines, Unique: 100_000, ErrorRate: 0.3},
+		{Seed: 6, Distribution: Exact, Unique: 50_000, Duplication: 2.5, ErrorRate: 0.1, MessyKinds: []string{"crlf", "blank"}},
+	}
+}
+
+// output depends only on seed and configuration, not on count of workers or
+// on writing chunks in parallel at their offsets
+func TestGenerateWorkers(t *testing.T) {
+	for _, cfg := range testGeneratorConfigs() {
+		var expected []byte
+		var truth *GeneratorResult
+		for _, workers := range []int{1, 3, 8} {
+			cfg.Workers = workers
+			buf := &bytes.Buffer{}
+			result := Generate(buf, cfg)
+
+			f, err := os.Create(filepath.Join(t.TempDir(), "ips.txt"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			Generate(f, cfg)
+			f.Close()
+			written, _ := os.ReadFile(f.Name())
+
+			if expected == nil {
+				expected, truth = buf.Bytes(), result
+			}
+			if !bytes.Equal(buf.Bytes(), expected) || !bytes.Equal(written, expected) {
+				t.Errorf("%s, seed %d: output of %d workers differs from output of 1 worker", cfg.Distribution, cfg.Seed, workers)
+			}
+			if result.Unique != truth.Unique || result.Valid != truth.Valid || result.Bytes != truth.Bytes {
+				t.Errorf("%s, seed %d: truth of %d workers %+v, expected %+v", cfg.Distribution, cfg.Seed, workers, result, truth)
+			}
+		}
+	}
+}
+
+// parses lines like Iterator does and returns count of lines, count of
+// invalid lines and count of each ip
+func countGenerated(data []byte) (lines, invalid uint64, counts map[uint32]uint64) {
+	counts = map[uint32]uint64{}
+	ips := make([]uint32, 256)
+	for len(data) > 0 {
+		n, consumed, err := ParseLines(data, ips)
+		lines += uint64(n)
+		for _, ip := range ips[:n] {
+			counts[ip]++
+		}
+		data = data[consumed:]
+		if err != nil {
+			lines++
+			invalid++
+			data = data[bytes.IndexByte(data, '\n') + 1:]
+		}
+	}
+	return lines, invalid, counts
+}
+
+// ground truth matches generated lines, and ips follow distribution
+func TestGenerateTruth(t *testing.T) {
+	for _, cfg := range testGeneratorConfigs() {
+		buf := &bytes.Buffer{}
+		truth := Generate(buf, cfg)
+		lines, invalid, counts := countGenerated(buf.Bytes())
+		name := fmt.Sprintf("%s, seed %d", cfg.Distribution, cfg.Seed)
+
+		if truth.Lines != lines || truth.Invalid != invalid || truth.Valid != lines - invalid ||
+			truth.Unique != uint64(len(counts)) || truth.Bytes != uint64(buf.Len()) {
+			t.Errorf(
+				"%s: truth %+v, generated %d lines, %d invalid, %d unique, %d bytes",
+				name, truth, lines, invalid, len(counts), buf.Len(),
+			)
+		}
+		if cfg.ErrorRate == 0 && invalid != 0 {
+			t.Errorf("%s: %d invalid lines without error rate", name, invalid)
+		}
+		messy := uint64(0)
+		for _, count := range truth.Messy {
+			messy += count
+		}
+		if rate := float64(messy) / float64(lines); rate < cfg.ErrorRate * 0.9 || rate > cfg.ErrorRate * 1.1 {
+			t.Errorf("%s: %.3f of lines are messy, expected %.3f", name, rate, cfg.ErrorRate)
+		}
+
+		top := uint64(0)
+		subnets := map[uint32]bool{}
+		for ip, count := range counts {
+			top = max(top, count)
+			subnets[ip >> cfg.ClusterBits] = true
+		}
+		switch cfg.Distribution {
+		case Uniform:
+			// expected count of distinct values of n uniform draws
+			n, u := float64(lines - invalid), float64(cfg.Unique)
+			expected := u * (1 - math.Exp(-n / u))
+			if math.Abs(float64(len(counts)) - expected) > expected * 0.01 || top > 30 {
+				t.Errorf("%s: %d unique, the most frequent ip repeated %d times", name, len(counts), top)
+			}
+		case Zipf:
+			// the most frequent address takes about 1/7 of lines
+			if top < lines / 20 {
+				t.Errorf("%s: the most frequent ip repeated %d times of %d lines", name, top, lines)
+			}
+		case Clustered:
+			if uint64(len(subnets)) != cfg.Clusters || len(counts) > int(cfg.Clusters << cfg.ClusterBits) {
+				t.Errorf("%s: %d subnets and %d unique ips, expected %d subnets", name, len(subnets), len(counts), cfg.Clusters)
+			}
+		case Exact:
+			expected := uint64(math.Round(float64(cfg.Unique) * cfg.Duplication))
+			if lines != expected || (cfg.ErrorRate == 0 && uint64(len(counts)) != cfg.Unique) {
+				t.Errorf("%s: %d lines and %d unique, expected %d and %d", name, lines, len(counts), expected, cfg.Unique)
+			}
+		}
+	}
+}
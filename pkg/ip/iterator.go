@@ -3,11 +3,10 @@ package ip
 import (
 	"bytes"
 	"context"
-	"encoding/binary"
 	"io"
 	"iter"
 	"math"
-	"os"
+	"runtime/trace"
 	"sync"
 
 	"ip_addr_counter/pkg/util"
@@ -16,132 +15,290 @@ import (
 const MaxIpAddrSize = len("255.255.255.255\r\n")
 const MinIpAddrSize = len("0.0.0.0\r\n")
 const MaxIpAddrValue = math.MaxUint32
+const MaxRangeSize = len("255.255.255.255-255.255.255.255\r\n")
 
-func Iterator(file *os.File, pageSize, cacheSize, count int) []iter.Seq[uint32] {
-	wg := &sync.WaitGroup{}
-	iterArr := make([]iter.Seq[uint32], count)
-	chArr := make([]chan uint32, count)
-	offsets := getOffsets(file, count)
-	fileSize := util.Must(file.Stat()).Size()
-	ctx, cancel := context.WithCancel(context.Background())
+// line aligned part of input read by single reader
+type Segment struct {
+	// index of input segment belongs to
+	Source int
+	io.Reader
+}
 
-	for i := range count {
-		ch := make(chan uint32, cacheSize)
-		chArr[i] = ch
-		iterArr[i] = func(yield func(uint32) bool) {
-			for ip := range ch {
-				if !yield(ip) {
-					cancel()
-					break
-				}
-			}
-		}
+// sequence of segments which must be read one after another by single reader,
+// e.g. members of compressed archive. Segments of seekable files are usually
+// independent jobs.
+type Job = iter.Seq[Segment]
+
+// reads jobs by readers goroutines in parallel and returns iterator per
+// partition of partitioner. Iterators yield index of input (Segment.Source)
+// and parsed ip. Each segment must start at the beginning of line and end at
+// the end of line, see Segments. Reads of all readers are limited by limiter,
+// nil means unlimited.
+func Iterator(
+	jobs []Job,
+	readers, pageSize, cacheSize int,
+	partitioner *Partitioner,
+	stats *Stats,
+	limiter *util.RateLimiter,
+) []iter.Seq2[int, uint32] {
+	return iterate(jobs, readers, pageSize, cacheSize, partitioner, stats, limiter, sendIPs)
+}
+
+// same as Iterator, but lines may also contain ranges or CIDRs (see ParseRange).
+// Ranges are split on partition boundaries, so each returned iterator only
+// yields ranges inside its own partition.
+func RangeIterator(
+	jobs []Job,
+	readers, pageSize, cacheSize int,
+	partitioner *Partitioner,
+	stats *Stats,
+	limiter *util.RateLimiter,
+) []iter.Seq2[int, Range] {
+	return iterate(jobs, readers, pageSize, cacheSize, partitioner, stats, limiter, sendRanges)
+}
+
+// returns job of independent segment
+func SingleJob(segment Segment) Job {
+	return func(yield func(Segment) bool) {
+		yield(segment)
 	}
+}
+
+// breaks file of given size into count segments of roughly equal size.
+// Segment bounds are moved to the beginnings of lines, lines may be longer
+// than maxLineSize, e.g. invalid ones, it is only the size of first read
+// looking for line end. Segments inside long line are empty.
+func Segments(file io.ReaderAt, size int64, count, maxLineSize int) []io.Reader {
+	segments := make([]io.Reader, count)
+	offsets := SegmentOffsets(file, size, count, maxLineSize)
 
 	for i := range count {
-		ipParser := Parser()
-		buf := bytes.NewBuffer(make([]byte, 0, pageSize))
-		read := int64(0)
-		from, to := int64(offsets[i]), int64(0)
-		if i == count - 1 {
-			to = fileSize
-		} else {
+		from, to := offsets[i], size
+		if i != count - 1 {
 			to = offsets[i + 1]
 		}
-		readCount := to - from
+		segments[i] = io.NewSectionReader(file, from, to - from)
+	}
+	return segments
+}
 
+// returns start offsets of segments returned by Segments
+func SegmentOffsets(file io.ReaderAt, size int64, count, maxLineSize int) []int64 {
+	offsets := getOffsets(file, size, count, maxLineSize)
+	for i := range offsets {
+		offsets[i] = min(offsets[i], size)
+	}
+	return offsets
+}
+
+// sender parses complete lines and pushes results into corresponding
+// partition batches. Returns false if reading was cancelled.
+type sender[T any] func(d *dispatcher[T], lines []byte) bool
+
+func iterate[T any](
+	jobs []Job,
+	readers, pageSize, cacheSize int,
+	partitioner *Partitioner,
+	stats *Stats,
+	limiter *util.RateLimiter,
+	send sender[T],
+) []iter.Seq2[int, T] {
+	wg := &sync.WaitGroup{}
+	iterArr := make([]iter.Seq2[int, T], partitioner.Count())
+	chArr := make([]chan batch[T], partitioner.Count())
+	pool := util.NewBatchPool[T](util.BatchSize)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	for i := range partitioner.Count() {
+		// values are passed in batches, cacheSize is rounded to batch size
+		chArr[i] = make(chan batch[T], util.BatchCount(cacheSize))
+		iterArr[i] = unbatch(chArr[i], pool, cancel)
+	}
+
+	// jobs are distributed between readers through channel
+	jobCh := make(chan Job, len(jobs))
+	for _, job := range jobs {
+		jobCh <- job
+	}
+	close(jobCh)
+
+	for range min(readers, len(jobs)) {
 		wg.Add(1)
 		go func () {
+			// read errors are logged instead of printing stack trace
+			defer util.ExitOnPanic()
 			defer wg.Done()
-			for {
-				ip, err := buf.ReadBytes('\n')
-				if err == io.EOF {
-					n, err := readPage(file, pageSize, buf, ip, from)
-					from += int64(n)
-					if n == 0 && err == io.EOF {
-						if len(ip) > 0 {
-							send(ctx, chArr, ipParser, ip)
-						}
-						break
-					} else if err != io.EOF && err != nil {
-						panic(err)
-					}
-				} else if err != nil {
-					panic(err)
-				} else {
-					read += int64(len(ip))
-					sent := send(ctx, chArr, ipParser, ip)
-					if read >= readCount || !sent {
-						break
+			d := newDispatcher(ctx, chArr, pool, partitioner)
+			defer d.release()
+
+			for job := range jobCh {
+				for segment := range job {
+					ok := d.setSource(segment.Source) && readSegment(segment, pageSize, limiter, func(lines []byte) bool {
+						defer d.updateStats(stats)
+						defer trace.StartRegion(ctx, "parse").End()
+						return send(d, lines)
+					})
+					if !ok {
+						return
 					}
 				}
 			}
+			d.flush()
 		}()
 	}
 
 	go func() {
 		wg.Wait()
 		cancel()
-		for i := range count {
-			close(chArr[i])
+		for _, ch := range chArr {
+			close(ch)
 		}
 	}()
 
 	return iterArr
 }
 
-func readPage(file *os.File, pageSize int, buf *bytes.Buffer, halfReadIp []byte, from int64) (int, error) {
-	buf.Write(halfReadIp)
-	buf.Grow(len(halfReadIp) + pageSize)
-	b := buf.Bytes()
-	b = b[:cap(b)]
-	n, err := file.ReadAt(b[len(halfReadIp):], from)
-	*buf = *bytes.NewBuffer(b[:len(halfReadIp) + n])
+// reads segment page by page and passes complete lines to fn. Last line of
+// segment is terminated with '\n' if it wasn't. Returns false if fn returned
+// false.
+func readSegment(r io.Reader, pageSize int, limiter *util.RateLimiter, fn func(lines []byte) bool) bool {
+	buf := make([]byte, pageSize)
+	tail := 0
+
+	for {
+		if tail == len(buf) {
+			// line is longer than page, growing buffer
+			buf = append(buf, make([]byte, len(buf))...)
+		}
+
+		region := trace.StartRegion(context.Background(), "read page")
+		n, err := readPage(r, buf[tail:], limiter)
+		region.End()
+		data := buf[:tail + n]
+		if err == io.EOF {
+			if len(data) > 0 && data[len(data) - 1] != '\n' {
+				data = append(data, '\n')
+			}
+			return len(data) == 0 || fn(data)
+		}
+		util.PanicIfErr(err)
+
+		end := bytes.LastIndexByte(data, '\n') + 1
+		if end > 0 && !fn(data[:end]) {
+			return false
+		}
+		tail = copy(buf, data[end:])
+	}
+}
+
+// fills page with data from r. Returns io.EOF if page wasn't filled completely.
+// Waits for limiter after reading, so rate of reads doesn't exceed its rate
+func readPage(r io.Reader, page []byte, limiter *util.RateLimiter) (int, error) {
+	n, err := io.ReadFull(r, page)
+	limiter.Wait(n)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
 	return n, err
 }
 
-func send(ctx context.Context, chArr []chan uint32, parser *parser, ip []byte) bool {
-	if ip[len(ip)-1] == '\n' {
-		ip = ip[:len(ip) - 1]
+func sendIPs(d *dispatcher[uint32], lines []byte) bool {
+	ips := [256]uint32{}
+	for len(lines) > 0 {
+		n, consumed, err := ParseLines(lines, ips[:])
+		d.lines += uint64(n)
+		for _, ip := range ips[:n] {
+			if !d.push(d.partitioner.Index(ip), ip) {
+				return false
+			}
+		}
+
+		lines = lines[consumed:]
+		if err != nil {
+			// skipping invalid line
+			d.lines++
+			d.invalid++
+			lines = lines[bytes.IndexByte(lines, '\n') + 1:]
+		}
 	}
-	if ip[len(ip)-1] == '\r' {
-		ip = ip[:len(ip) - 1]
+	return true
+}
+
+func sendRanges(d *dispatcher[Range], lines []byte) bool {
+	for len(lines) > 0 {
+		i := bytes.IndexByte(lines, '\n')
+		r, err := ParseRange(trimLine(lines[:i]))
+		lines = lines[i+1:]
+		d.lines++
+		if err != nil {
+			// skipping invalid line
+			d.invalid++
+			continue
+		}
+
+		for {
+			// splitting range on partition boundaries
+			index := d.partitioner.Index(r.From)
+			part := r
+			if _, to := d.partitioner.Range(index); uint64(r.To) > to {
+				part.To = uint32(to)
+			}
+
+			if !d.push(index, part) {
+				return false
+			}
+
+			if part.To == r.To {
+				break
+			}
+			r.From = part.To + 1
+		}
 	}
-	ipParsed := binary.BigEndian.Uint32(util.Must(parser.Parse(ip)))
-	select {
-	case <-ctx.Done():
-		return false
-	case chArr[getIndex(ipParsed, len(chArr))] <- ipParsed:
-		return true
+	return true
+}
+
+// removes trailing '\r' left from CRLF line endings
+func trimLine(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line) - 1]
 	}
+	return line
 }
 
-func getOffsets(file *os.File, count int) []int64 {
+// returns start offsets of count segments of roughly equal size. Offsets are
+// moved forward to the beginnings of lines, offset of segment which would
+// start inside the last line is at or past the end of file. Lines may be of any
+// length, lineSize is the size of the first read looking for line end.
+func getOffsets(file io.ReaderAt, fileSize int64, count, lineSize int) []int64 {
 	offsets := make([]int64, count)
 	offsets[0] = 0
 
-	fileSize := util.Must(file.Stat()).Size()
 	sizePerIterator := fileSize / int64(count)
-	
-	b := make([]byte, MaxIpAddrSize)
-	for i := 1; i < count; i++ {
-		n, err := file.ReadAt(b, offsets[i - 1] + sizePerIterator)
-		if err == io.EOF {
-			b = b[:n]
-		} else {
-			util.PanicIfErr(err)
-		}
 
-		ip, err := bytes.NewBuffer(b).ReadBytes('\n')
-		if err != io.EOF {
-			util.PanicIfErr(err)
-		}
-		offsets[i] = offsets[i - 1] + sizePerIterator + int64(len(ip))
+	b := make([]byte, lineSize)
+	for i := 1; i < count; i++ {
+		offsets[i], b = nextLine(file, offsets[i - 1] + sizePerIterator, b)
 	}
 
 	return offsets
 }
 
-func getIndex(ip uint32, count int) int {
-	return int(float64(count) * float64(ip) / float64(MaxIpAddrValue + 1))
+// returns offset following the first '\n' at or after offset, or offset of
+// the end of file if there is no '\n'. buf is doubled while line end isn't
+// found in it, grown buf is returned for the following calls.
+func nextLine(file io.ReaderAt, offset int64, buf []byte) (int64, []byte) {
+	for {
+		n, err := file.ReadAt(buf, offset)
+		if err != io.EOF {
+			util.PanicIfErr(err)
+		}
+		if i := bytes.IndexByte(buf[:n], '\n'); i != -1 {
+			return offset + int64(i) + 1, buf
+		}
+		offset += int64(n)
+		if err == io.EOF {
+			return offset, buf
+		}
+		buf = make([]byte, 2 * len(buf))
+	}
 }
@@ -0,0 +1,103 @@
+package ip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+// kind of messy line produced by generator with GeneratorConfig.ErrorRate.
+// Lines look like real world input, Valid tells if parser is expected to
+// accept line, so unique count of ips of valid lines is known.
+type MessyKind struct {
+	Name   string
+	Valid  bool
+	// appends line without '\n' for ip to dst, r is random value of line
+	format func(dst []byte, ip uint32, r uint64) []byte
+}
+
+var MessyKinds = []*MessyKind{
+	{"crlf", true, func(dst []byte, ip uint32, r uint64) []byte {
+		return append(AppendIP(dst, ip), '\r')
+	}},
+	{"blank", false, func(dst []byte, ip uint32, r uint64) []byte {
+		return dst
+	}},
+	{"bom", false, func(dst []byte, ip uint32, r uint64) []byte {
+		return AppendIP(append(dst, "\xef\xbb\xbf"...), ip)
+	}},
+	{"trailing_space", false, func(dst []byte, ip uint32, r uint64) []byte {
+		dst = AppendIP(dst, ip)
+		for range 1 + r % 3 {
+			dst = append(dst, " \t"[r >> 8 % 2])
+		}
+		return dst
+	}},
+	{"invalid_octet", false, func(dst []byte, ip uint32, r uint64) []byte {
+		// one of octets is greater than 255
+		octet := int(r % 4)
+		for i := range 4 {
+			v := uint64(byte(ip >> ((3 - i) * 8)))
+			if i == octet {
+				v = 256 + r >> 8 % 744
+			}
+			dst = strconv.AppendUint(dst, v, 10)
+			if i < 3 {
+				dst = append(dst, '.')
+			}
+		}
+		return dst
+	}},
+	{"missing_octet", false, func(dst []byte, ip uint32, r uint64) []byte {
+		dst = AppendIP(dst, ip)
+		return dst[:bytes.LastIndexByte(dst, '.')]
+	}},
+	{"ipv6", false, func(dst []byte, ip uint32, r uint64) []byte {
+		if r % 2 == 0 {
+			// ipv4 mapped address
+			return AppendIP(append(dst, "::ffff:"...), ip)
+		}
+		dst = append(dst, "2001:db8:"...)
+		dst = strconv.AppendUint(dst, uint64(ip >> 16), 16)
+		dst = append(dst, ':')
+		return strconv.AppendUint(dst, uint64(uint16(ip)), 16)
+	}},
+	{"port", false, func(dst []byte, ip uint32, r uint64) []byte {
+		dst = append(AppendIP(dst, ip), ':')
+		return strconv.AppendUint(dst, 1 + r % 65535, 10)
+	}},
+	{"csv", false, func(dst []byte, ip uint32, r uint64) []byte {
+		dst = strconv.AppendUint(dst, r % 1_000_000, 10)
+		dst = append(dst, ',')
+		dst = append(AppendIP(dst, ip), ",GET,"...)
+		return strconv.AppendUint(dst, 200 + r >> 20 % 4 * 100, 10)
+	}},
+	{"log", false, func(dst []byte, ip uint32, r uint64) []byte {
+		dst = append(AppendIP(dst, ip), ` - - [10/Oct/2024:13:55:36 +0000] "GET /`...)
+		dst = strconv.AppendUint(dst, r % 1000, 10)
+		dst = append(dst, ` HTTP/1.1" 200 `...)
+		return strconv.AppendUint(dst, r >> 10 % 10000, 10)
+	}},
+}
+
+// returns messy kinds by names, all kinds if names are empty
+func messyKinds(names []string) []*MessyKind {
+	if len(names) == 0 {
+		return MessyKinds
+	}
+
+	kinds := []*MessyKind{}
+	for _, name := range names {
+		found := false
+		for _, kind := range MessyKinds {
+			if kind.Name == name {
+				kinds = append(kinds, kind)
+				found = true
+			}
+		}
+		if !found {
+			panic(fmt.Errorf("unknown messy line kind %q", name))
+		}
+	}
+	return kinds
+}
@@ -1,6 +1,7 @@
 package ip
 
 import (
+	"net/netip"
 	"strconv"
 
 	"ip_addr_counter/pkg/util"
@@ -45,3 +46,7 @@ func (p *parser) Parse(src []byte) ([]byte, error) {
 	return p.intIp, nil
 }
 
+// formats ip as dotted decimal string
+func ToString(ip uint32) string {
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}).String()
+}
@@ -0,0 +1,139 @@
+package ip
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"slices"
+
+	"ip_addr_counter/pkg/util"
+)
+
+// count of consecutive lines parsed after each random seek while sampling
+const sampleLinesPerRead = 64
+
+// routes ips into partitions. Each partition holds continuous range of ips,
+// partitions are ordered by their ranges.
+type Partitioner struct {
+	// bounds[i] is the first ip of (i+1)'th partition. Nil for uniform partitioner.
+	bounds []uint32
+	count  int
+}
+
+// splits ip space into count equal ranges
+func UniformPartitioner(count int) *Partitioner {
+	return &Partitioner{count: count}
+}
+
+// splits ip space by quantiles of samples, so each partition receives roughly
+// the same amount of ips distributed like samples
+func QuantilePartitioner(samples []uint32, count int) *Partitioner {
+	if len(samples) == 0 {
+		return UniformPartitioner(count)
+	}
+
+	slices.Sort(samples)
+	bounds := make([]uint32, count - 1)
+	for i := range bounds {
+		bounds[i] = samples[(i + 1) * len(samples) / count]
+	}
+	return &Partitioner{bounds: bounds, count: count}
+}
+
+func (p *Partitioner) Count() int {
+	return p.count
+}
+
+// returns index of partition ip belongs to
+func (p *Partitioner) Index(ip uint32) int {
+	if p.bounds == nil {
+		return int(uint64(ip) * uint64(p.count) >> 32)
+	}
+
+	// count of bounds less or equal to ip
+	lo, hi := 0, len(p.bounds)
+	for lo < hi {
+		mid := int(uint(lo + hi) >> 1)
+		if p.bounds[mid] <= ip {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+// returns inclusive range of ips of i'th partition. Partition is empty if
+// from is greater than to, it is possible for repeated quantile bounds and
+// for partitions before zero bounds of skewed samples.
+func (p *Partitioner) Range(i int) (from, to uint64) {
+	if p.bounds == nil {
+		from = (uint64(i) << 32 + uint64(p.count) - 1) / uint64(p.count)
+		to = (uint64(i + 1) << 32 + uint64(p.count) - 1) / uint64(p.count) - 1
+		return from, to
+	}
+
+	from, to = 0, MaxIpAddrValue
+	if i > 0 {
+		from = uint64(p.bounds[i - 1])
+	}
+	if i < len(p.bounds) {
+		if p.bounds[i] == 0 {
+			// no ip is less than zero bound
+			return 1, 0
+		}
+		to = uint64(p.bounds[i]) - 1
+	}
+	return from, to
+}
+
+// returns true if no ip is routed into i'th partition
+func (p *Partitioner) Empty(i int) bool {
+	from, to := p.Range(i)
+	return from > to
+}
+
+// reads about sampleSize lines (ips, ranges or CIDRs) from random positions
+// of file of given size and returns their start addresses. Invalid lines are skipped.
+func Sample(file io.ReaderAt, fileSize int64, sampleSize, maxLineSize int) []uint32 {
+	if fileSize == 0 || sampleSize == 0 {
+		return nil
+	}
+
+	// seed is fixed, so the same file is always partitioned the same way
+	rnd := rand.New(rand.NewPCG(uint64(fileSize), uint64(sampleSize)))
+	samples := make([]uint32, 0, sampleSize)
+	buf := make([]byte, maxLineSize * (sampleLinesPerRead + 1))
+
+	for range (sampleSize + sampleLinesPerRead - 1) / sampleLinesPerRead {
+		offset := rnd.Int64N(fileSize)
+		n, err := file.ReadAt(buf, offset)
+		if err != io.EOF {
+			util.PanicIfErr(err)
+		}
+
+		lines := buf[:n]
+		if offset != 0 {
+			// skipping partially read line, the whole read may be inside
+			// long line
+			i := bytes.IndexByte(lines, '\n')
+			if i == -1 {
+				continue
+			}
+			lines = lines[i + 1:]
+		}
+
+		for range sampleLinesPerRead {
+			i := bytes.IndexByte(lines, '\n')
+			if i == -1 {
+				break
+			}
+			if r, err := ParseRange(trimLine(lines[:i])); err == nil {
+				samples = append(samples, r.From)
+			}
+			lines = lines[i + 1:]
+		}
+	}
+
+	return samples
+}
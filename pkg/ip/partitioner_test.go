@@ -0,0 +1,61 @@
+package ip
+
+import (
+	"testing"
+)
+
+// checks that non-empty ranges of partitions cover whole ip space in order
+// and that their bounds are routed into their partitions
+func checkRanges(t *testing.T, p *Partitioner) {
+	t.Helper()
+	next := uint64(0)
+	for i := range p.Count() {
+		from, to := p.Range(i)
+		if p.Empty(i) != (from > to) {
+			t.Errorf("partition %d: range %d - %d, empty %v", i, from, to, p.Empty(i))
+		}
+		if p.Empty(i) {
+			continue
+		}
+		if from != next || to > MaxIpAddrValue {
+			t.Errorf("partition %d: range %d - %d, expected to start at %d and end before %d", i, from, to, next, uint64(MaxIpAddrValue) + 1)
+		}
+		if p.Index(uint32(from)) != i || p.Index(uint32(to)) != i {
+			t.Errorf("partition %d: bounds %d and %d are routed into %d and %d", i, from, to, p.Index(uint32(from)), p.Index(uint32(to)))
+		}
+		next = to + 1
+	}
+	if next != MaxIpAddrValue + 1 {
+		t.Errorf("partitions end at %d", next)
+	}
+}
+
+func TestPartitionerRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		p       *Partitioner
+		empty   []int
+	}{
+		{"uniform", UniformPartitioner(7), nil},
+		{"single", UniformPartitioner(1), nil},
+		{"quantile", QuantilePartitioner([]uint32{10, 20, 30, 40, 50, 60, 70, 80}, 4), nil},
+		{"zero bounds", &Partitioner{bounds: []uint32{0, 0, 5}, count: 4}, []int{0, 1}},
+		{"duplicate bounds", &Partitioner{bounds: []uint32{5, 5, 5, MaxIpAddrValue}, count: 5}, []int{1, 2}},
+		{"max bound", &Partitioner{bounds: []uint32{MaxIpAddrValue}, count: 2}, nil},
+		// skewed samples, e.g. file of zeros
+		{"zero samples", QuantilePartitioner(make([]uint32, 100), 4), []int{0, 1, 2}},
+		{"max samples", QuantilePartitioner([]uint32{MaxIpAddrValue, MaxIpAddrValue}, 3), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkRanges(t, tt.p)
+			for _, i := range tt.empty {
+				if !tt.p.Empty(i) {
+					from, to := tt.p.Range(i)
+					t.Errorf("partition %d: range %d - %d, expected empty", i, from, to)
+				}
+			}
+		})
+	}
+}
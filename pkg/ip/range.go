@@ -0,0 +1,60 @@
+package ip
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"ip_addr_counter/pkg/util"
+)
+
+// inclusive range of ip addresses
+type Range struct {
+	From uint32
+	To   uint32
+}
+
+// parses single ip address ("1.2.3.4"), explicit range ("1.2.3.0-1.2.5.255")
+// or CIDR ("10.0.0.0/8") into inclusive range of addresses.
+func ParseRange(src []byte) (Range, error) {
+	if i := bytes.IndexByte(src, '-'); i != -1 {
+		from, err := ParseUint32(bytes.TrimSpace(src[:i]))
+		if err != nil {
+			return Range{}, err
+		}
+		to, err := ParseUint32(bytes.TrimSpace(src[i+1:]))
+		if err != nil {
+			return Range{}, err
+		}
+		if from > to {
+			return Range{}, fmt.Errorf("invalid range %q: start is greater than end", src)
+		}
+		return Range{from, to}, nil
+	}
+
+	if i := bytes.IndexByte(src, '/'); i != -1 {
+		addr, err := ParseUint32(src[:i])
+		if err != nil {
+			return Range{}, err
+		}
+		prefixLen, err := strconv.ParseUint(util.BytesToString(src[i+1:]), 10, 8)
+		if err != nil {
+			return Range{}, err
+		} else if prefixLen > 32 {
+			return Range{}, fmt.Errorf("invalid CIDR %q: prefix length is greater than 32", src)
+		}
+		mask := uint32(uint64(MaxIpAddrValue) << (32 - prefixLen))
+		return Range{addr & mask, addr | ^mask}, nil
+	}
+
+	addr, err := ParseUint32(src)
+	if err != nil {
+		return Range{}, err
+	}
+	return Range{addr, addr}, nil
+}
+
+// returns count of addresses covered by range
+func (r Range) Len() uint64 {
+	return uint64(r.To) - uint64(r.From) + 1
+}
@@ -0,0 +1,99 @@
+package ip
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		src   string
+		from  string
+		to    string
+		valid bool
+	}{
+		{"1.2.3.4", "1.2.3.4", "1.2.3.4", true},
+		{"1.2.3.0-1.2.5.255", "1.2.3.0", "1.2.5.255", true},
+		{"1.2.3.0 - 1.2.5.255", "1.2.3.0", "1.2.5.255", true},
+		{"1.2.3.4-1.2.3.4", "1.2.3.4", "1.2.3.4", true},
+		{"0.0.0.0-255.255.255.255", "0.0.0.0", "255.255.255.255", true},
+		{"10.0.0.0/8", "10.0.0.0", "10.255.255.255", true},
+		{"192.168.1.0/24", "192.168.1.0", "192.168.1.255", true},
+		// host bits of CIDR are ignored
+		{"192.168.1.77/24", "192.168.1.0", "192.168.1.255", true},
+		{"0.0.0.0/0", "0.0.0.0", "255.255.255.255", true},
+		{"1.2.3.4/0", "0.0.0.0", "255.255.255.255", true},
+		{"1.2.3.4/32", "1.2.3.4", "1.2.3.4", true},
+		{"1.2.3.5/31", "1.2.3.4", "1.2.3.5", true},
+		// reversed range
+		{"1.2.5.255-1.2.3.0", "", "", false},
+		{"1.2.3.5-1.2.3.4", "", "", false},
+		// invalid masks
+		{"1.2.3.4/33", "", "", false},
+		{"1.2.3.4/-1", "", "", false},
+		{"1.2.3.4/", "", "", false},
+		{"1.2.3.4/8/8", "", "", false},
+		{"1.2.3.4/x", "", "", false},
+		{"1.2.3.4/255.0.0.0", "", "", false},
+		{"1.2.3/8", "", "", false},
+		// invalid addresses
+		{"", "", "", false},
+		{"-", "", "", false},
+		{"1.2.3.4-", "", "", false},
+		{"-1.2.3.4", "", "", false},
+		{"1.2.3.4-1.2.3.256", "", "", false},
+		{"1.2.3.4-5.6.7.8-9.9.9.9", "", "", false},
+	}
+
+	for _, tt := range tests {
+		r, err := ParseRange([]byte(tt.src))
+		if !tt.valid {
+			if err == nil {
+				t.Errorf("ParseRange(%q) = %s - %s, expected error", tt.src, ToString(r.From), ToString(r.To))
+			}
+			continue
+		}
+		if err != nil || ToString(r.From) != tt.from || ToString(r.To) != tt.to {
+			t.Errorf("ParseRange(%q) = %s - %s, %v, expected %s - %s", tt.src, ToString(r.From), ToString(r.To), err, tt.from, tt.to)
+		}
+	}
+}
+
+// ranges are split on partition boundaries, each partition yields only its
+// own part of range
+func TestRangeIteratorSplit(t *testing.T) {
+	data := "63.255.255.0-64.0.0.255\n0.0.0.0/0\n1.2.3.4\r\n9.9.9.9-1.1.1.1\n"
+	partitioner := UniformPartitioner(4)
+	jobs := []Job{SingleJob(Segment{Reader: strings.NewReader(data)})}
+	stats := &Stats{}
+
+	parts := [][]string{}
+	for i, it := range RangeIterator(jobs, 1, 64, 1024, partitioner, stats, nil) {
+		from, to := partitioner.Range(i)
+		list := []string{}
+		for _, r := range it {
+			if uint64(r.From) < from || uint64(r.To) > to || r.From > r.To {
+				t.Errorf("partition %d yields %s - %s", i, ToString(r.From), ToString(r.To))
+			}
+			list = append(list, ToString(r.From) + "-" + ToString(r.To))
+		}
+		slices.Sort(list)
+		parts = append(parts, list)
+	}
+
+	expected := [][]string{
+		{"0.0.0.0-63.255.255.255", "1.2.3.4-1.2.3.4", "63.255.255.0-63.255.255.255"},
+		{"64.0.0.0-127.255.255.255", "64.0.0.0-64.0.0.255"},
+		{"128.0.0.0-191.255.255.255"},
+		{"192.0.0.0-255.255.255.255"},
+	}
+	for i := range expected {
+		if !slices.Equal(parts[i], expected[i]) {
+			t.Errorf("partition %d yields %v, expected %v", i, parts[i], expected[i])
+		}
+	}
+	if stats.Lines != 4 || stats.Invalid != 1 {
+		t.Errorf("lines %d, invalid %d, expected 4 and 1", stats.Lines, stats.Invalid)
+	}
+}
@@ -0,0 +1,99 @@
+package ip
+
+import (
+	"bufio"
+	"io"
+)
+
+// builds line aligned segments of compressed file consisting of independently
+// decompressible blocks (see compress.BlockOffsets). offsets are compressed
+// offsets of blocks starting segments, open returns decompressed data of
+// compressed range [from, to). Decompressed data of block range doesn't start
+// and end at line bounds, so each segment except first skips its first partial
+// line and each segment except last reads following blocks until the end of
+// its last line. Lines may be longer than segments, segment starting and
+// ending inside the same line is empty.
+func BlockSegments(offsets []int64, size int64, open func(from, to int64) io.Reader) []io.Reader {
+	segments := make([]io.Reader, len(offsets))
+	for i, from := range offsets {
+		to := size
+		if i != len(offsets) - 1 {
+			to = offsets[i + 1]
+		}
+
+		var body io.Reader = &lazyReader{open: func() io.Reader { return open(from, to) }}
+		var skipper *lineSkipper
+		if i != 0 {
+			skipper = &lineSkipper{r: bufio.NewReader(body)}
+			body = skipper
+		}
+
+		if i == len(offsets) - 1 {
+			segments[i] = body
+		} else {
+			tail := &lazyReader{open: func() io.Reader { return open(to, size) }}
+			segments[i] = io.MultiReader(body, &lineReader{r: bufio.NewReader(tail), after: skipper})
+		}
+	}
+	return segments
+}
+
+// opens underlying reader on first read
+type lazyReader struct {
+	open func() io.Reader
+	r    io.Reader
+}
+
+func (lr *lazyReader) Read(p []byte) (int, error) {
+	if lr.r == nil {
+		lr.r = lr.open()
+	}
+	return lr.r.Read(p)
+}
+
+// skips data up to and including first '\n'
+type lineSkipper struct {
+	r       *bufio.Reader
+	skipped bool
+}
+
+func (ls *lineSkipper) Read(p []byte) (int, error) {
+	for !ls.skipped {
+		_, err := ls.r.ReadSlice('\n')
+		if err == nil {
+			ls.skipped = true
+		} else if err != bufio.ErrBufferFull {
+			return 0, err
+		}
+	}
+	return ls.r.Read(p)
+}
+
+// reads data up to and including first '\n'. Nothing is read if after didn't
+// find line end, then the line is read by one of previous segments
+type lineReader struct {
+	r       *bufio.Reader
+	after   *lineSkipper
+	pending []byte
+	done    bool
+}
+
+func (lr *lineReader) Read(p []byte) (int, error) {
+	if len(lr.pending) == 0 {
+		if lr.done || (lr.after != nil && !lr.after.skipped) {
+			return 0, io.EOF
+		}
+
+		line, err := lr.r.ReadSlice('\n')
+		if err == nil || err == io.EOF {
+			lr.done = true
+		} else if err != bufio.ErrBufferFull {
+			return 0, err
+		}
+		lr.pending = line
+	}
+
+	n := copy(p, lr.pending)
+	lr.pending = lr.pending[n:]
+	return n, nil
+}
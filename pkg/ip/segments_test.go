@@ -0,0 +1,100 @@
+package ip
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+// returns lines of valid ips mixed with invalid lines much longer than
+// MaxIpAddrSize and segments
+func longLines() []byte {
+	data := &bytes.Buffer{}
+	for i := range 200 {
+		switch i % 7 {
+		case 3:
+			data.WriteString("2001:0db8:85a3:0000:0000:8a2e:0370:7334\n")
+		case 5:
+			data.WriteString("GET /index.html from 10.0.0.1 " + strings.Repeat("x", i * 13) + "\n")
+		default:
+			data.WriteString("10.0.0.1\r\n")
+		}
+	}
+	// the last line without line end
+	data.WriteString(strings.Repeat("y", 5000))
+	return data.Bytes()
+}
+
+// checks that segments are line aligned and together hold the whole data
+func checkSegments(t *testing.T, data []byte, segments []io.Reader) {
+	t.Helper()
+	all := []byte{}
+	for i, s := range segments {
+		segment, err := io.ReadAll(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(segment) > 0 && len(all) > 0 && all[len(all) - 1] != '\n' {
+			t.Fatalf("segment %d starts inside line: %q", i, segment[:min(len(segment), 20)])
+		}
+		all = append(all, segment...)
+	}
+	if !bytes.Equal(all, data) {
+		t.Fatalf("segments hold %d bytes, expected %d bytes of data", len(all), len(data))
+	}
+}
+
+func TestSegmentsLongLines(t *testing.T) {
+	data := longLines()
+	for count := 1; count <= 64; count++ {
+		r := bytes.NewReader(data)
+		offsets := SegmentOffsets(r, int64(len(data)), count, MaxIpAddrSize)
+		for i := 1; i < count; i++ {
+			if offsets[i] < offsets[i - 1] {
+				t.Fatalf("%d segments: offsets aren't ascending: %v", count, offsets)
+			}
+		}
+		checkSegments(t, data, Segments(r, int64(len(data)), count, MaxIpAddrSize))
+	}
+}
+
+func TestBlockSegmentsLongLines(t *testing.T) {
+	data := longLines()
+	r := bytes.NewReader(data)
+	open := func(from, to int64) io.Reader {
+		return io.NewSectionReader(r, from, to - from)
+	}
+
+	// blocks are smaller than long lines, so some segments are inside them
+	for _, blockSize := range []int64{7, 100, 1000, 4096} {
+		offsets := []int64{}
+		for offset := int64(0); offset < int64(len(data)); offset += blockSize {
+			offsets = append(offsets, offset)
+		}
+		checkSegments(t, data, BlockSegments(offsets, int64(len(data)), open))
+	}
+}
+
+// counts of lines must not depend on count of readers splitting input
+func TestIteratorLongLines(t *testing.T) {
+	data := longLines()
+	for _, readers := range []int{1, 3, 7, 20} {
+		r := bytes.NewReader(data)
+		jobs := []Job{}
+		for _, s := range Segments(r, int64(len(data)), readers, MaxIpAddrSize) {
+			jobs = append(jobs, SingleJob(Segment{Reader: s}))
+		}
+
+		stats := &Stats{}
+		count := 0
+		for _, it := range Iterator(jobs, readers, 64, 1024, UniformPartitioner(4), stats, nil) {
+			for range it {
+				count++
+			}
+		}
+		if stats.Lines != 201 || stats.Invalid != 58 || count != 143 {
+			t.Errorf("%d readers: lines %d, invalid %d, ips %d, expected 201, 58 and 143", readers, stats.Lines, stats.Invalid, count)
+		}
+	}
+}
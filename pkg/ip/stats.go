@@ -0,0 +1,11 @@
+package ip
+
+// counters of lines read by Iterator and RangeIterator. Updated atomically
+// by readers after each page, so they can be read while reading is in progress
+// with atomic.LoadUint64.
+type Stats struct {
+	// count of lines including invalid ones
+	Lines   uint64
+	// count of skipped lines, which are not valid ips (or ranges)
+	Invalid uint64
+}
@@ -0,0 +1,245 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// monotonically increasing value, safe for concurrent use
+type Counter struct {
+	v uint64
+	// padding to cache line, counters are updated by different goroutines
+	_ [56]byte
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+// value which can go up and down, safe for concurrent use
+type Gauge struct {
+	v int64
+	_ [56]byte
+}
+
+func (g *Gauge) Add(n int64) {
+	atomic.AddInt64(&g.v, n)
+}
+
+func (g *Gauge) Set(n int64) {
+	atomic.StoreInt64(&g.v, n)
+}
+
+func (g *Gauge) Value() int64 {
+	return atomic.LoadInt64(&g.v)
+}
+
+// distribution of observed values counted in buckets, safe for concurrent use
+type Histogram struct {
+	// upper bounds of buckets in increasing order, the last bucket (+Inf)
+	// isn't included
+	bounds []float64
+	// counts of values of each bucket (not cumulative), including +Inf one
+	counts []Counter
+	// bits of float64 sum of values
+	sum    uint64
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i].Inc()
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		if atomic.CompareAndSwapUint64(&h.sum, old, math.Float64bits(math.Float64frombits(old) + v)) {
+			return
+		}
+	}
+}
+
+// set of metrics of the same name distinguished by value of single label
+type Vec[T any] struct {
+	label  string
+	m      sync.RWMutex
+	values map[string]*T
+}
+
+// returns metric of label value, creating it on first call
+func (v *Vec[T]) With(value string) *T {
+	v.m.RLock()
+	metric, ok := v.values[value]
+	v.m.RUnlock()
+	if ok {
+		return metric
+	}
+
+	v.m.Lock()
+	defer v.m.Unlock()
+	if metric, ok = v.values[value]; !ok {
+		metric = new(T)
+		v.values[value] = metric
+	}
+	return metric
+}
+
+// same as With, but label value is integer (e.g. partition index)
+func (v *Vec[T]) WithInt(value int) *T {
+	return v.With(strconv.Itoa(value))
+}
+
+type CounterVec = Vec[Counter]
+type GaugeVec = Vec[Gauge]
+
+// metric written in Prometheus text format
+type metric struct {
+	name, help, kind string
+	// writes samples of metric
+	write func(w io.Writer, name string)
+}
+
+// set of metrics exposed in Prometheus text format
+type Registry struct {
+	m       sync.Mutex
+	metrics []*metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// registers metric. Nil registry ignores metrics, so they can be updated
+// without being exposed
+func (r *Registry) register(name, help, kind string, write func(w io.Writer, name string)) {
+	if r == nil {
+		return
+	}
+	r.m.Lock()
+	defer r.m.Unlock()
+	r.metrics = append(r.metrics, &metric{name, help, kind, write})
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, c.Value())
+	})
+	return c
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(name, help, "gauge", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, g.Value())
+	})
+	return g
+}
+
+// registers counter which value is returned by f on each scrape
+func (r *Registry) CounterFunc(name, help string, f func() uint64) {
+	r.register(name, help, "counter", func(w io.Writer, name string) {
+		fmt.Fprintf(w, "%s %d\n", name, f())
+	})
+}
+
+// registers histogram of given bucket upper bounds, +Inf bucket is added
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{bounds: buckets, counts: make([]Counter, len(buckets) + 1)}
+	r.register(name, help, "histogram", func(w io.Writer, name string) {
+		// buckets are cumulative
+		total := uint64(0)
+		for i, c := range h.counts {
+			total += c.Value()
+			le := "+Inf"
+			if i < len(h.bounds) {
+				le = formatFloat(h.bounds[i])
+			}
+			fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, le, total)
+		}
+		fmt.Fprintf(w, "%s_sum %s\n", name, formatFloat(math.Float64frombits(atomic.LoadUint64(&h.sum))))
+		fmt.Fprintf(w, "%s_count %d\n", name, total)
+	})
+	return h
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func (r *Registry) CounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{label: label, values: map[string]*Counter{}}
+	r.register(name, help, "counter", func(w io.Writer, name string) {
+		writeVec(w, name, v, func(c *Counter) string {
+			return strconv.FormatUint(c.Value(), 10)
+		})
+	})
+	return v
+}
+
+func (r *Registry) GaugeVec(name, help, label string) *GaugeVec {
+	v := &GaugeVec{label: label, values: map[string]*Gauge{}}
+	r.register(name, help, "gauge", func(w io.Writer, name string) {
+		writeVec(w, name, v, func(g *Gauge) string {
+			return strconv.FormatInt(g.Value(), 10)
+		})
+	})
+	return v
+}
+
+// writes samples of vec ordered by label value, numeric values are ordered
+// as numbers
+func writeVec[T any](w io.Writer, name string, v *Vec[T], value func(*T) string) {
+	v.m.RLock()
+	defer v.m.RUnlock()
+
+	keys := make([]string, 0, len(v.values))
+	for k := range v.values {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if len(keys[i]) != len(keys[j]) {
+			return len(keys[i]) < len(keys[j])
+		}
+		return keys[i] < keys[j]
+	})
+
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", name, v.label, escape(k), value(v.values[k]))
+	}
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// writes all metrics in Prometheus text format
+func (r *Registry) Write(w io.Writer) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	for _, m := range r.metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+		m.write(w, m.name)
+	}
+}
+
+// returns handler serving metrics in Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
@@ -0,0 +1,77 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+)
+
+// metrics are written in Prometheus text format in order of registration
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("lines_total", "Lines read.").Add(42)
+	r.Gauge("open_files", "Open files.").Set(-3)
+	r.CounterFunc("errors_total", "Invalid lines.", func() uint64 { return 7 })
+
+	partitions := r.CounterVec("inserts_total", "Inserted values.", "partition")
+	// label values are ordered as numbers
+	partitions.WithInt(10).Add(5)
+	partitions.WithInt(2).Inc()
+	partitions.WithInt(2).Inc()
+
+	phases := r.GaugeVec("phase", "Running phase.", "phase")
+	phases.With(`a"b\c` + "\nd").Set(1)
+
+	h := r.Histogram("flush_seconds", "Flush durations.", []float64{0.1, 1, 2.5})
+	for _, v := range []float64{0.05, 0.1, 0.5, 3, 10} {
+		h.Observe(v)
+	}
+
+	expected := `# HELP lines_total Lines read.
+# TYPE lines_total counter
+lines_total 42
+# HELP open_files Open files.
+# TYPE open_files gauge
+open_files -3
+# HELP errors_total Invalid lines.
+# TYPE errors_total counter
+errors_total 7
+# HELP inserts_total Inserted values.
+# TYPE inserts_total counter
+inserts_total{partition="2"} 2
+inserts_total{partition="10"} 5
+# HELP phase Running phase.
+# TYPE phase gauge
+phase{phase="a\"b\\c\nd"} 1
+# HELP flush_seconds Flush durations.
+# TYPE flush_seconds histogram
+flush_seconds_bucket{le="0.1"} 2
+flush_seconds_bucket{le="1"} 3
+flush_seconds_bucket{le="2.5"} 3
+flush_seconds_bucket{le="+Inf"} 5
+flush_seconds_sum 13.65
+flush_seconds_count 5
+`
+	out := &bytes.Buffer{}
+	r.Write(out)
+	if out.String() != expected {
+		t.Errorf("written metrics:\n%s\nexpected:\n%s", out, expected)
+	}
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; version=0.0.4; charset=utf-8" || rec.Body.String() != expected {
+		t.Errorf("handler served %q with content type %q", rec.Body, ct)
+	}
+}
+
+// metrics of nil registry are updated, but not exposed
+func TestNilRegistry(t *testing.T) {
+	var r *Registry
+	c := r.Counter("lines_total", "Lines read.")
+	c.Inc()
+	r.Histogram("flush_seconds", "Flush durations.", []float64{1}).Observe(2)
+	if c.Value() != 1 {
+		t.Errorf("counter value %d, expected 1", c.Value())
+	}
+}
@@ -0,0 +1,41 @@
+package progress
+
+import (
+	"log/slog"
+	"time"
+)
+
+// returns reporter logging each snapshot as separate record of Info level
+func Log(logger *slog.Logger) Reporter {
+	return &logReporter{logger: logger}
+}
+
+type logReporter struct {
+	logger *slog.Logger
+}
+
+func (l *logReporter) Report(s Snapshot) {
+	l.logger.Info("progress", "progress", s)
+}
+
+// implements slog.LogValuer interface
+func (s Snapshot) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.String("phase", s.Phase),
+		slog.Uint64("bytes", s.Bytes),
+		slog.Uint64("total_bytes", s.TotalBytes),
+		slog.Uint64("count", s.Count),
+		slog.Uint64("invalid", s.Invalid),
+		slog.Uint64("unique", s.Unique),
+		slog.Int64("bytes_per_sec", int64(s.ByteRate())),
+		slog.Int64("count_per_sec", int64(s.Rate())),
+		slog.Duration("elapsed", s.Elapsed.Round(time.Millisecond)),
+	}
+	if eta, ok := s.ETA(); ok && !s.Done {
+		attrs = append(attrs, slog.Duration("eta", eta.Round(time.Second)))
+	}
+	if s.Done {
+		attrs = append(attrs, slog.Bool("done", true))
+	}
+	return slog.GroupValue(attrs...)
+}
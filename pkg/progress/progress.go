@@ -0,0 +1,105 @@
+package progress
+
+import (
+	"sync"
+	"time"
+)
+
+// state of running phase at some moment. Snapshots are built from atomically
+// updated counters, so they can be passed between goroutines freely.
+type Snapshot struct {
+	// "write" or "read"
+	Phase      string
+	Elapsed    time.Duration
+	// processed bytes of input files (write) or runs (read)
+	Bytes      uint64
+	// total bytes of phase, zero if unknown (e.g. input is stdin)
+	TotalBytes uint64
+	// count of read lines (write) or values read from runs (read)
+	Count      uint64
+	// count of invalid lines (write)
+	Invalid    uint64
+	// count of unique values found so far (read)
+	Unique     uint64
+	// true for the last snapshot of phase
+	Done       bool
+}
+
+// returns processed part of phase, false if total is unknown
+func (s Snapshot) Fraction() (float64, bool) {
+	if s.TotalBytes == 0 {
+		return 0, false
+	}
+	return min(float64(s.Bytes) / float64(s.TotalBytes), 1), true
+}
+
+// returns count of processed lines (values) per second
+func (s Snapshot) Rate() float64 {
+	return perSecond(s.Count, s.Elapsed)
+}
+
+// returns count of processed bytes per second
+func (s Snapshot) ByteRate() float64 {
+	return perSecond(s.Bytes, s.Elapsed)
+}
+
+// returns estimated time left until the end of phase, false if it can't be
+// estimated yet
+func (s Snapshot) ETA() (time.Duration, bool) {
+	rate := s.ByteRate()
+	if s.TotalBytes == 0 || rate == 0 {
+		return 0, false
+	}
+	left := float64(s.TotalBytes) - float64(min(s.Bytes, s.TotalBytes))
+	return time.Duration(left / rate * float64(time.Second)), true
+}
+
+func perSecond(n uint64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(n) / d.Seconds()
+}
+
+// receives snapshots of running phase periodically and once at its end
+// (with Snapshot.Done set). Calls are never concurrent.
+type Reporter interface {
+	Report(s Snapshot)
+}
+
+// returns reporter ignoring all snapshots
+func Nop() Reporter {
+	return nop{}
+}
+
+type nop struct{}
+
+func (nop) Report(Snapshot) {}
+
+// reporter remembering last snapshot and passing snapshots to another reporter
+type Recorder struct {
+	Reporter
+	m    sync.Mutex
+	last *Snapshot
+}
+
+func Record(r Reporter) *Recorder {
+	return &Recorder{Reporter: r}
+}
+
+func (r *Recorder) Report(s Snapshot) {
+	r.m.Lock()
+	r.last = &s
+	r.m.Unlock()
+	r.Reporter.Report(s)
+}
+
+// returns last reported snapshot, false if nothing was reported yet
+func (r *Recorder) Last() (Snapshot, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if r.last == nil {
+		return Snapshot{}, false
+	}
+	return *r.last, true
+}
@@ -0,0 +1,131 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// width of bar drawn by Bar reporter in characters
+const barWidth = 30
+
+// returns reporter redrawing single line progress bar on terminal. Other
+// output into the same terminal (e.g. logs) must be written through t, so it
+// doesn't mix with bar line
+func Bar(t *Terminal) Reporter {
+	return &bar{t: t}
+}
+
+type bar struct {
+	t *Terminal
+}
+
+func (b *bar) Report(s Snapshot) {
+	filled := 0
+	if fraction, ok := s.Fraction(); ok {
+		filled = int(fraction * barWidth)
+	}
+
+	line := fmt.Sprintf(
+		"[%s%s] %s",
+		strings.Repeat("=", filled), strings.Repeat(" ", barWidth - filled), Format(s),
+	)
+	b.t.draw(line, s.Done)
+}
+
+// writer shared by progress bar and other output into terminal. Bar line is
+// cleared before each write and redrawn after it, so written lines (e.g. log
+// records) are printed above bar. Safe for concurrent use.
+type Terminal struct {
+	m    sync.Mutex
+	w    io.Writer
+	// currently drawn bar line, empty if there is none
+	line string
+}
+
+func NewTerminal(w io.Writer) *Terminal {
+	return &Terminal{w: w}
+}
+
+func (t *Terminal) Write(p []byte) (int, error) {
+	t.m.Lock()
+	defer t.m.Unlock()
+	if t.line == "" {
+		return t.w.Write(p)
+	}
+
+	fmt.Fprintf(t.w, "\r%s\r", strings.Repeat(" ", len(t.line)))
+	n, err := t.w.Write(p)
+	fmt.Fprint(t.w, t.line)
+	return n, err
+}
+
+// replaces bar line with line. Done line is kept and following output starts
+// at new line
+func (t *Terminal) draw(line string, done bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	// erasing rest of previous line if it was longer
+	pad := max(0, len(t.line) - len(line))
+	fmt.Fprintf(t.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	t.line = line
+	if done {
+		fmt.Fprintln(t.w)
+		t.line = ""
+	}
+}
+
+// checks if f is terminal, so progress bar can be drawn
+func IsTerminal(f *os.File) bool {
+	stat, err := f.Stat()
+	return err == nil && stat.Mode() & os.ModeCharDevice != 0
+}
+
+// returns human readable snapshot
+func Format(s Snapshot) string {
+	sb := &strings.Builder{}
+	fmt.Fprintf(sb, "%s", s.Phase)
+	if fraction, ok := s.Fraction(); ok {
+		fmt.Fprintf(sb, " %5.1f%% %s/%s", 100 * fraction, Bytes(s.Bytes), Bytes(s.TotalBytes))
+	} else {
+		fmt.Fprintf(sb, " %s", Bytes(s.Bytes))
+	}
+
+	unit := "lines"
+	if s.Phase == "read" {
+		unit = "values"
+	}
+	fmt.Fprintf(sb, " | %d %s, %s/s, %.0f %s/s", s.Count, unit, Bytes(uint64(s.ByteRate())), s.Rate(), unit)
+	if s.Invalid > 0 {
+		fmt.Fprintf(sb, " | invalid %d", s.Invalid)
+	}
+	if s.Unique > 0 {
+		fmt.Fprintf(sb, " | unique %d", s.Unique)
+	}
+
+	fmt.Fprintf(sb, " | elapsed %s", s.Elapsed.Round(time.Second))
+	if s.Done {
+		sb.WriteString(" | done")
+	} else if eta, ok := s.ETA(); ok {
+		fmt.Fprintf(sb, " | ETA %s", eta.Round(time.Second))
+	}
+	return sb.String()
+}
+
+// returns size in human readable units
+func Bytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n) / float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,30 @@
+package progress
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// log lines written while bar is drawn are printed above bar, which is
+// redrawn after them
+func TestTerminal(t *testing.T) {
+	out := &bytes.Buffer{}
+	term := NewTerminal(out)
+	bar := &bar{t: term}
+
+	term.Write([]byte("before\n"))
+	bar.Report(Snapshot{Phase: "write", Bytes: 50, TotalBytes: 100})
+	line := term.line
+	term.Write([]byte("log\n"))
+	bar.Report(Snapshot{Phase: "write", Bytes: 100, TotalBytes: 100, Done: true})
+	term.Write([]byte("after\n"))
+
+	clear := "\r" + strings.Repeat(" ", len(line)) + "\r"
+	if !strings.HasPrefix(out.String(), "before\n\r" + line + clear + "log\n" + line + "\r") {
+		t.Fatalf("log line isn't printed above bar: %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), "done\nafter\n") {
+		t.Fatalf("output after done bar isn't printed at new line: %q", out.String())
+	}
+}
@@ -0,0 +1,21 @@
+package source
+
+import "bytes"
+
+type BytesSource struct {
+	*bytes.Reader
+	name string
+}
+
+// returns source reading in-memory data
+func Bytes(name string, data []byte) *BytesSource {
+	return &BytesSource{Reader: bytes.NewReader(data), name: name}
+}
+
+func (bs *BytesSource) Name() string {
+	return bs.name
+}
+
+func (bs *BytesSource) Close() error {
+	return nil
+}
@@ -0,0 +1,34 @@
+package source
+
+import (
+	"fmt"
+	"os"
+)
+
+type FileSource struct {
+	*os.File
+	size int64
+}
+
+// opens regular local file. Returns ErrNotSeekable for pipes, fifos and
+// other non-regular files, they can be read only as streams
+func File(path string) (*FileSource, error) {
+	f, err := os.OpenFile(path, os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	} else if !stat.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("%w: %s", ErrNotSeekable, path)
+	}
+	return &FileSource{File: f, size: stat.Size()}, nil
+}
+
+func (fs *FileSource) Size() int64 {
+	return fs.size
+}
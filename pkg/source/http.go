@@ -0,0 +1,104 @@
+package source
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// source reading remote file by http Range requests
+type HTTPSource struct {
+	client *http.Client
+	url    string
+	size   int64
+}
+
+// checks that server supports Range requests and returns source of file at
+// url. Returns ErrNotSeekable if server doesn't support them, size of file is
+// unknown or server doesn't support HEAD requests (405 or 501), then file can
+// still be read by HTTPStream. Other statuses (e.g. 404) are returned as
+// errors. nil client means http.DefaultClient
+func HTTP(client *http.Client, url string) (*HTTPSource, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Head(url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, fmt.Errorf("%w: HEAD %s: %s", ErrNotSeekable, url, resp.Status)
+	default:
+		return nil, fmt.Errorf("HEAD %s: %s", url, resp.Status)
+	}
+	if !strings.Contains(resp.Header.Get("Accept-Ranges"), "bytes") || resp.ContentLength < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNotSeekable, url)
+	}
+	return &HTTPSource{client: client, url: url, size: resp.ContentLength}, nil
+}
+
+func (hs *HTTPSource) ReadAt(p []byte, off int64) (int, error) {
+	if off >= hs.size {
+		return 0, io.EOF
+	}
+	end := min(off + int64(len(p)), hs.size)
+	if end == off {
+		return 0, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, hs.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end - 1))
+
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, fmt.Errorf("GET %s range %d-%d: %s", hs.url, off, end - 1, resp.Status)
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:end - off])
+	if err == nil && end != off + int64(len(p)) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (hs *HTTPSource) Size() int64 {
+	return hs.size
+}
+
+func (hs *HTTPSource) Name() string {
+	return hs.url
+}
+
+func (hs *HTTPSource) Close() error {
+	return nil
+}
+
+// returns body of file at url, for servers not supporting Range requests
+func HTTPStream(client *http.Client, url string) (io.ReadCloser, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	} else if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -0,0 +1,129 @@
+package source
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testData = []byte(strings.Repeat("1.2.3.4\n10.0.0.1\n", 1000))
+
+// serves testData with Range support, HEAD is answered by ServeContent too
+func rangeHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeContent(w, r, "ips.txt", time.Time{}, bytes.NewReader(testData))
+}
+
+// serves testData without Range support
+func plainHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write(testData)
+}
+
+// serves testData by GET only, like some object storages and CDNs
+func noHeadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Write(testData)
+}
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(rangeHandler))
+	defer server.Close()
+
+	src, err := HTTP(server.Client(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if src.Size() != int64(len(testData)) || src.Name() != server.URL {
+		t.Fatalf("size %d, name %s, expected %d and %s", src.Size(), src.Name(), len(testData), server.URL)
+	}
+
+	// segments are read concurrently
+	wg := &sync.WaitGroup{}
+	for _, off := range []int64{0, 1, 7, 1000, int64(len(testData)) - 9} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := make([]byte, 9)
+			n, err := src.ReadAt(p, off)
+			if err != nil || !bytes.Equal(p[:n], testData[off:off + 9]) {
+				t.Errorf("ReadAt(%d) = %q, %v, expected %q", off, p[:n], err, testData[off:off + 9])
+			}
+		}()
+	}
+	wg.Wait()
+
+	// reads at the end of file
+	p := make([]byte, 20)
+	n, err := src.ReadAt(p, int64(len(testData)) - 5)
+	if n != 5 || err != io.EOF || !bytes.Equal(p[:n], testData[len(testData) - 5:]) {
+		t.Errorf("ReadAt of last 5 bytes = %q, %v, expected %q and EOF", p[:n], err, testData[len(testData) - 5:])
+	}
+	if n, err := src.ReadAt(p, int64(len(testData))); n != 0 || err != io.EOF {
+		t.Errorf("ReadAt after the end = %d, %v, expected EOF", n, err)
+	}
+}
+
+// servers without Range support are read by single GET request
+func TestHTTPStreamFallback(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{"no accept ranges", plainHandler},
+		{"head not allowed", noHeadHandler},
+		{"head not implemented", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusNotImplemented)
+				return
+			}
+			w.Write(testData)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			if _, err := HTTP(server.Client(), server.URL); !errors.Is(err, ErrNotSeekable) {
+				t.Fatalf("HTTP error %v, expected ErrNotSeekable", err)
+			}
+			rc, err := HTTPStream(server.Client(), server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data, err := io.ReadAll(rc)
+			if err != nil || !bytes.Equal(data, testData) {
+				t.Errorf("stream of %d bytes, %v, expected %d bytes", len(data), err, len(testData))
+			}
+		})
+	}
+}
+
+// statuses other than 405 and 501 aren't fallen back to stream
+func TestHTTPErrors(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusUnauthorized, http.StatusInternalServerError} {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+
+		_, err := HTTP(server.Client(), server.URL)
+		if err == nil || errors.Is(err, ErrNotSeekable) || !strings.Contains(err.Error(), http.StatusText(status)) {
+			t.Errorf("HTTP error %v, expected %d", err, status)
+		}
+		if _, err := HTTPStream(server.Client(), server.URL); err == nil || !strings.Contains(err.Error(), http.StatusText(status)) {
+			t.Errorf("HTTPStream error %v, expected %d", err, status)
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,21 @@
+package source
+
+import (
+	"errors"
+	"io"
+)
+
+// returned when source can't be read at arbitrary offsets, e.g. http server
+// ignoring Range header. Such source can still be read as stream.
+var ErrNotSeekable = errors.New("source doesn't support random access")
+
+// input with random access, e.g. local file, in-memory data or remote file.
+// Segments of source are read in parallel, so ReadAt must be safe for
+// concurrent use.
+type Interface interface {
+	io.ReaderAt
+	io.Closer
+	Size() int64
+	// name of source used in diagnostics and per input counts
+	Name() string
+}
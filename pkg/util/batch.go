@@ -0,0 +1,63 @@
+package util
+
+import (
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// count of elements in single batch passed between goroutines
+const BatchSize = 16 * 1024
+
+// pool of fixed capacity slices used to recycle batches
+type BatchPool[T any] struct {
+	pool  sync.Pool
+	// count of batches got and not put back yet
+	taken atomic.Int64
+}
+
+func NewBatchPool[T any](size int) *BatchPool[T] {
+	return &BatchPool[T]{pool: sync.Pool{New: func() any {
+		batch := make([]T, 0, size)
+		return &batch
+	}}}
+}
+
+// returns empty batch
+func (bp *BatchPool[T]) Get() []T {
+	bp.taken.Add(1)
+	return (*bp.pool.Get().(*[]T))[:0]
+}
+
+func (bp *BatchPool[T]) Put(batch []T) {
+	bp.taken.Add(-1)
+	bp.pool.Put(&batch)
+}
+
+// returns count of batches got from pool and not put back yet. Batches
+// dropped by cancelled iterations are never put back
+func (bp *BatchPool[T]) Taken() int64 {
+	return bp.taken.Load()
+}
+
+// returns iterator yielding elements of batches received from ch. Each batch
+// is returned to pool after all its elements are yielded. cancel is called
+// if iteration is stopped before ch is closed.
+func Unbatch[T any](ch <-chan []T, pool *BatchPool[T], cancel func()) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for batch := range ch {
+			for _, v := range batch {
+				if !yield(v) {
+					cancel()
+					return
+				}
+			}
+			pool.Put(batch)
+		}
+	}
+}
+
+// returns count of batches fitting into cacheSize elements, but at least one
+func BatchCount(cacheSize int) int {
+	return max(1, cacheSize / BatchSize)
+}
@@ -0,0 +1,75 @@
+package util
+
+import (
+	"testing"
+)
+
+// returns channel of count batches of pool holding consecutive values
+func testBatches(pool *BatchPool[int], count, size int) <-chan []int {
+	ch := make(chan []int, count)
+	v := 0
+	for range count {
+		batch := pool.Get()
+		for range size {
+			batch = append(batch, v)
+			v++
+		}
+		ch <- batch
+	}
+	close(ch)
+	return ch
+}
+
+func TestUnbatch(t *testing.T) {
+	pool := NewBatchPool[int](8)
+	cancelled := false
+	expected := 0
+	for v := range Unbatch(testBatches(pool, 5, 8), pool, func() { cancelled = true }) {
+		if v != expected {
+			t.Fatalf("value %d, expected %d", v, expected)
+		}
+		expected++
+	}
+
+	if expected != 40 {
+		t.Errorf("%d values, expected 40", expected)
+	}
+	if cancelled {
+		t.Error("iteration is cancelled after all values are read")
+	}
+	if pool.Taken() != 0 {
+		t.Errorf("%d batches aren't returned into pool", pool.Taken())
+	}
+}
+
+func TestUnbatchCancel(t *testing.T) {
+	pool := NewBatchPool[int](8)
+	cancels := 0
+	for v := range Unbatch(testBatches(pool, 5, 8), pool, func() { cancels++ }) {
+		if v == 19 {
+			break
+		}
+	}
+
+	if cancels != 1 {
+		t.Errorf("cancel is called %d times, expected once", cancels)
+	}
+	// two read batches are returned, batch being read and unread ones are not
+	if pool.Taken() != 3 {
+		t.Errorf("%d batches are taken, expected 3", pool.Taken())
+	}
+}
+
+func TestBatchCount(t *testing.T) {
+	tests := []struct{ cacheSize, count int }{
+		{0, 1},
+		{BatchSize - 1, 1},
+		{BatchSize, 1},
+		{3 * BatchSize + 1, 3},
+	}
+	for _, tt := range tests {
+		if count := BatchCount(tt.cacheSize); count != tt.count {
+			t.Errorf("BatchCount(%d) = %d, expected %d", tt.cacheSize, count, tt.count)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package util
+
+import (
+	"math/bits"
+	"sync/atomic"
+)
+
+// set of integers in [0, size), bit per value. Bits are set atomically, so
+// bitmap is safe for concurrent use
+type Bitmap []uint64
+
+func NewBitmap(size uint64) Bitmap {
+	return make(Bitmap, (size + 63) / 64)
+}
+
+// adds inclusive range of values
+func (b Bitmap) Set(from, to uint64) {
+	for v := from; v <= to; {
+		word, bit := v / 64, v % 64
+		n := min(64 - bit, to - v + 1)
+		if n == 64 {
+			atomic.StoreUint64(&b[word], ^uint64(0))
+		} else {
+			atomic.OrUint64(&b[word], (uint64(1) << n - 1) << bit)
+		}
+		v += n
+	}
+}
+
+// adds value, returns false if it was already added
+func (b Bitmap) Add(v uint64) bool {
+	mask := uint64(1) << (v % 64)
+	return atomic.OrUint64(&b[v / 64], mask) & mask == 0
+}
+
+// returns count of values in set
+func (b Bitmap) Count() uint64 {
+	n := 0
+	for _, word := range b {
+		n += bits.OnesCount64(word)
+	}
+	return uint64(n)
+}
@@ -0,0 +1,21 @@
+//go:build linux && (amd64 || arm64)
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// see posix_fadvise(2)
+const fadvSequential = 2
+const fadvDontNeed = 4
+
+// advises whole file
+func fadvise(f *os.File, advice int) error {
+	_, _, errno := syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, uintptr(advice), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
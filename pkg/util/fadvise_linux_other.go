@@ -0,0 +1,14 @@
+//go:build linux && !amd64 && !arm64
+
+package util
+
+import "os"
+
+const fadvSequential = 2
+const fadvDontNeed = 4
+
+// arguments of fadvise syscall differ on 32-bit architectures, hints are
+// skipped there
+func fadvise(f *os.File, advice int) error {
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !linux && !darwin
+
+package util
+
+import "errors"
+
+var errLimitsUnsupported = errors.New("not supported on this platform")
+
+// free disk space isn't available on this platform
+func FreeSpace(path string) (uint64, error) {
+	return 0, errLimitsUnsupported
+}
+
+// open files limit isn't available on this platform
+func OpenFilesLimit() (uint64, error) {
+	return 0, errLimitsUnsupported
+}
+
+// device of file isn't available on this platform
+func DeviceID(path string) (uint64, error) {
+	return 0, errLimitsUnsupported
+}
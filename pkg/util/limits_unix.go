@@ -0,0 +1,35 @@
+//go:build linux || darwin
+
+package util
+
+import (
+	"os"
+	"syscall"
+)
+
+// returns count of bytes available to unprivileged user on file system of path
+func FreeSpace(path string) (uint64, error) {
+	st := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), nil
+}
+
+// returns soft limit of open files of process
+func OpenFilesLimit() (uint64, error) {
+	rl := syscall.Rlimit{}
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rl); err != nil {
+		return 0, err
+	}
+	return uint64(rl.Cur), nil
+}
+
+// returns id of device holding file at path
+func DeviceID(path string) (uint64, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(stat.Sys().(*syscall.Stat_t).Dev), nil
+}
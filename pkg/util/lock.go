@@ -0,0 +1,5 @@
+package util
+
+import "errors"
+
+var ErrLocked = errors.New("file is locked by another process")
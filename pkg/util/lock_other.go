@@ -0,0 +1,23 @@
+//go:build !linux && !darwin
+
+package util
+
+import "os"
+
+// file locking isn't supported on this platform, lock file is only created
+type FileLock struct {
+	file *os.File
+}
+
+// creates file at path, it is never reported as locked
+func TryLock(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileLock{f}, nil
+}
+
+func (l *FileLock) Unlock() error {
+	return l.file.Close()
+}
@@ -0,0 +1,36 @@
+//go:build linux || darwin
+
+package util
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// advisory exclusive lock of file. Lock is released by Unlock or by OS when
+// process exits, so lock held by crashed process doesn't block others
+type FileLock struct {
+	file *os.File
+}
+
+// locks file at path without waiting, file is created if it doesn't exist.
+// Returns ErrLocked if file is locked by another process
+func TryLock(path string) (*FileLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrLocked
+		}
+		return nil, err
+	}
+	return &FileLock{f}, nil
+}
+
+func (l *FileLock) Unlock() error {
+	return l.file.Close()
+}
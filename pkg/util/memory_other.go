@@ -0,0 +1,13 @@
+//go:build !unix
+
+package util
+
+import "runtime"
+
+// returns memory obtained by go runtime from OS in bytes, since peak resident
+// set size isn't available
+func PeakRSS() uint64 {
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
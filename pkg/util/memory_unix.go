@@ -0,0 +1,21 @@
+//go:build unix
+
+package util
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// returns peak resident set size of process in bytes
+func PeakRSS() uint64 {
+	ru := syscall.Rusage{}
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &ru); err != nil {
+		return 0
+	}
+	// ru_maxrss is in bytes on darwin and in kilobytes on other systems
+	if runtime.GOOS == "darwin" {
+		return uint64(ru.Maxrss)
+	}
+	return uint64(ru.Maxrss) * 1024
+}
@@ -0,0 +1,49 @@
+//go:build linux
+
+package util
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// see ioprio_set(2)
+const ioprioWhoProcess = 1
+const ioprioClassIdle = 3
+const ioprioClassShift = 13
+
+// moves process into idle io scheduling class, so it gets disk time only
+// when other processes don't use disk. Priority is set for every thread,
+// since it is per thread on linux, threads created later inherit it
+func LowerIOPriority() error {
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return err
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		_, _, errno := syscall.Syscall(
+			syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle << ioprioClassShift,
+		)
+		// thread may exit while priorities are set
+		if errno != 0 && errno != syscall.ESRCH {
+			return errno
+		}
+	}
+	return nil
+}
+
+// hints kernel that file will be read sequentially
+func AdviseSequential(f *os.File) error {
+	return fadvise(f, fadvSequential)
+}
+
+// hints kernel that data of file won't be accessed soon, so its pages can be
+// dropped from page cache instead of pages of other processes
+func DropCache(f *os.File) error {
+	return fadvise(f, fadvDontNeed)
+}
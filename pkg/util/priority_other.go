@@ -0,0 +1,23 @@
+//go:build !linux
+
+package util
+
+import (
+	"errors"
+	"os"
+)
+
+// io priority can be lowered on linux only
+func LowerIOPriority() error {
+	return errors.New("io priority can't be lowered on this platform")
+}
+
+// page cache hints are supported on linux only
+func AdviseSequential(f *os.File) error {
+	return nil
+}
+
+// page cache hints are supported on linux only
+func DropCache(f *os.File) error {
+	return nil
+}
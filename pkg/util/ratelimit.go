@@ -0,0 +1,70 @@
+package util
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// token bucket limiting rate of bytes read or written by several goroutines.
+// Bucket holds tokens of one second. Nil limiter doesn't limit anything
+type RateLimiter struct {
+	m      sync.Mutex
+	// bytes per second
+	rate   float64
+	// may be negative, if tokens are borrowed by waiting goroutines
+	tokens float64
+	last   time.Time
+	// clock of limiter, replaced in tests
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+// returns limiter of bytesPerSec, nil if bytesPerSec is zero
+func NewRateLimiter(bytesPerSec uint64) *RateLimiter {
+	if bytesPerSec == 0 {
+		return nil
+	}
+	rate := float64(bytesPerSec)
+	return &RateLimiter{rate: rate, tokens: rate, last: time.Now(), now: time.Now, sleep: time.Sleep}
+}
+
+// takes n tokens and sleeps until they are refilled if bucket doesn't hold
+// enough of them. n may exceed size of bucket
+func (l *RateLimiter) Wait(n int) {
+	if l == nil || n <= 0 {
+		return
+	}
+
+	l.m.Lock()
+	now := l.now()
+	l.tokens = min(l.rate, l.tokens + now.Sub(l.last).Seconds() * l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	// debt of this and previous callers must be refilled
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.m.Unlock()
+
+	if wait > 0 {
+		l.sleep(wait)
+	}
+}
+
+type rateLimitedReader struct {
+	r io.Reader
+	l *RateLimiter
+}
+
+// returns reader waiting for limiter after each read, r if limiter is nil
+func RateLimitedReader(r io.Reader, l *RateLimiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &rateLimitedReader{r, l}
+}
+
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.l.Wait(n)
+	return n, err
+}
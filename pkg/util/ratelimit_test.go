@@ -0,0 +1,85 @@
+package util
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+	"time"
+)
+
+// clock of limiter advanced by test. If sleeps advance it, limiter is used by
+// single goroutine, otherwise sleeps are of concurrent goroutines
+type testClock struct {
+	now     time.Time
+	sleeps  []time.Duration
+	advance bool
+}
+
+func testLimiter(bytesPerSec uint64, advance bool) (*RateLimiter, *testClock) {
+	c := &testClock{now: time.Unix(0, 0), advance: advance}
+	l := NewRateLimiter(bytesPerSec)
+	l.last, l.now = c.now, func() time.Time { return c.now }
+	l.sleep = func(d time.Duration) {
+		c.sleeps = append(c.sleeps, d)
+		if c.advance {
+			c.now = c.now.Add(d)
+		}
+	}
+	return l, c
+}
+
+func TestRateLimiter(t *testing.T) {
+	type wait struct {
+		// time passed before Wait
+		after time.Duration
+		n     int
+	}
+	tests := []struct {
+		name    string
+		advance bool
+		waits   []wait
+		sleeps  []time.Duration
+	}{
+		{"burst of full bucket", true, []wait{{0, 600}, {0, 400}}, nil},
+		{"burst exceeded", true, []wait{{0, 1000}, {0, 500}}, []time.Duration{500 * time.Millisecond}},
+		{"refill", true, []wait{{0, 1000}, {250 * time.Millisecond, 250}, {100 * time.Millisecond, 200}}, []time.Duration{100 * time.Millisecond}},
+		{"bucket isn't refilled over its size", true, []wait{{10 * time.Second, 1500}}, []time.Duration{500 * time.Millisecond}},
+		{"read larger than bucket", true, []wait{{0, 3000}, {0, 1000}}, []time.Duration{2 * time.Second, time.Second}},
+		{"debt of concurrent readers", false, []wait{{0, 1500}, {0, 1000}}, []time.Duration{500 * time.Millisecond, 1500 * time.Millisecond}},
+		{"empty reads", true, []wait{{0, 1000}, {0, 0}, {0, -1}}, nil},
+	}
+
+	for _, tt := range tests {
+		l, c := testLimiter(1000, tt.advance)
+		for _, w := range tt.waits {
+			c.now = c.now.Add(w.after)
+			l.Wait(w.n)
+		}
+		if !slices.Equal(c.sleeps, tt.sleeps) {
+			t.Errorf("%s: slept %v, expected %v", tt.name, c.sleeps, tt.sleeps)
+		}
+	}
+}
+
+// limiter waits for bytes of each read, nil limiter doesn't limit anything
+func TestRateLimitedReader(t *testing.T) {
+	if NewRateLimiter(0) != nil {
+		t.Fatal("limiter of zero rate isn't nil")
+	}
+	var nilLimiter *RateLimiter
+	nilLimiter.Wait(100)
+	r := bytes.NewReader(nil)
+	if RateLimitedReader(r, nil) != io.Reader(r) {
+		t.Error("reader isn't returned as is for nil limiter")
+	}
+
+	l, c := testLimiter(1000, true)
+	data, err := io.ReadAll(RateLimitedReader(bytes.NewReader(make([]byte, 2500)), l))
+	if err != nil || len(data) != 2500 {
+		t.Fatalf("read %d bytes, %v", len(data), err)
+	}
+	if elapsed := c.now.Sub(time.Unix(0, 0)); elapsed != 1500 * time.Millisecond {
+		t.Errorf("2500 bytes read in %v, expected 1.5s", elapsed)
+	}
+}
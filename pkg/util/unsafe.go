@@ -14,6 +14,11 @@ func BytesTo[P pointer[T], T any](buf []byte) P {
 	return (P)(unsafe.Pointer(&buf[0]))
 }
 
+func SliceToBytes[T any](s []T) []byte {
+	var t T
+	return unsafe.Slice((*byte)(unsafe.Pointer(unsafe.SliceData(s))), len(s) * int(unsafe.Sizeof(t)))
+}
+
 func BytesToString(bytes []byte) string {
 	return unsafe.String(unsafe.SliceData(bytes), len(bytes))
 }
@@ -1,6 +1,9 @@
 package util
 
 import (
+	"context"
+	"log/slog"
+	"os"
 	"time"
 )
 
@@ -15,22 +18,41 @@ func Must[T any](val T, err error) T {
 	return val
 }
 
+// errors are reported by panics. Logs recovered panic as error and exits with
+// code 1 instead of printing stack trace, unless debug logs are enabled. Must
+// be deferred by main and by goroutines which may fail, e.g. on full disk
+func ExitOnPanic() {
+	if r := recover(); r != nil {
+		if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+			panic(r)
+		}
+		slog.Error("failed", "err", r)
+		os.Exit(1)
+	}
+}
+
+// calls f every interval until stop is called. stop waits for running call
+// of f to return
 func SetInterval(f func(start, now time.Time), interval time.Duration) (stop func()) {
 	start := time.Now()
-	stopChan := make(chan struct{}, 1)
+	stopChan := make(chan struct{})
+	doneChan := make(chan struct{})
+	ticker := time.NewTicker(interval)
 	go func () {
-		L: for {
+		defer close(doneChan)
+		defer ticker.Stop()
+		for {
 			select {
-			case now := <-time.Tick(time.Second):
+			case now := <-ticker.C:
 				f(start, now)
 			case <-stopChan:
-				close(stopChan)
-				break L
+				return
 			}
 		}
 	}()
 
 	return func() {
-		stopChan <- struct{}{}
+		close(stopChan)
+		<-doneChan
 	}
 }
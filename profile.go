@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"log/slog"
+	"net/http"
+	_ "net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+
+	"ip_addr_counter/pkg/util"
+)
+
+// registers profiling flags of subcommand. Returned start must be called after
+// flags are parsed, it starts requested profiling and returns function which
+// stops it and writes profiles.
+func profileFlags(flags *flag.FlagSet) (start func() (stop func())) {
+	cpuProfile := flags.String("cpuprofile", "", "write cpu profile into file")
+	memProfile := flags.String("memprofile", "", "write heap profile into file at exit")
+	traceFile := flags.String("trace", "", "write execution trace into file, see go tool trace")
+	pprofAddr := flags.String("pprof-addr", "", "address to serve net/http/pprof at /debug/pprof/, e.g. localhost:6060")
+
+	return func() (stop func()) {
+		stops := []func(){}
+
+		if *pprofAddr != "" {
+			slog.Info("serving pprof", "addr", *pprofAddr)
+			go func() {
+				util.PanicIfErr(http.ListenAndServe(*pprofAddr, http.DefaultServeMux))
+			}()
+		}
+
+		if *cpuProfile != "" {
+			f := util.Must(os.Create(*cpuProfile))
+			util.PanicIfErr(pprof.StartCPUProfile(f))
+			stops = append(stops, func() {
+				pprof.StopCPUProfile()
+				util.PanicIfErr(f.Close())
+				slog.Info("cpu profile written", "file", *cpuProfile)
+			})
+		}
+
+		if *traceFile != "" {
+			f := util.Must(os.Create(*traceFile))
+			util.PanicIfErr(trace.Start(f))
+			stops = append(stops, func() {
+				trace.Stop()
+				util.PanicIfErr(f.Close())
+				slog.Info("trace written", "file", *traceFile)
+			})
+		}
+
+		if *memProfile != "" {
+			stops = append(stops, func() {
+				f := util.Must(os.Create(*memProfile))
+				// collecting garbage to get up-to-date statistics
+				runtime.GC()
+				util.PanicIfErr(pprof.WriteHeapProfile(f))
+				util.PanicIfErr(f.Close())
+				slog.Info("heap profile written", "file", *memProfile)
+			})
+		}
+
+		return func() {
+			for _, stop := range stops {
+				stop()
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ip_addr_counter/pkg/ip"
+)
+
+// cpu and heap profiles and execution trace with regions of pipeline steps
+// are written at exit, even if count fails
+func TestProfiles(t *testing.T) {
+	lines := &strings.Builder{}
+	for i := range 5000 {
+		fmt.Fprintf(lines, "10.0.%d.%d\n", i >> 8, i & 0xff)
+	}
+	dir := t.TempDir()
+	input := filepath.Join(dir, "ips.txt")
+	if err := os.WriteFile(input, []byte(lines.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTruth(filepath.Join(dir, "wrong.truth.json"), &ip.GeneratorResult{Lines: 5000, Unique: 4999})
+
+	for _, test := range []struct {
+		flags []string
+		code  int
+	}{
+		{nil, 0},
+		{[]string{"-expect", filepath.Join(dir, "wrong.truth.json")}, 1},
+	} {
+		profiles := t.TempDir()
+		cpu, mem, trace := filepath.Join(profiles, "cpu"), filepath.Join(profiles, "mem"), filepath.Join(profiles, "trace")
+		args := append([]string{"-cpuprofile", cpu, "-memprofile", mem, "-trace", trace, "-dst", t.TempDir()}, test.flags...)
+		if code, _ := runCount(t, append(args, input)...); code != test.code {
+			t.Fatalf("%v: exit code %d, expected %d", test.flags, code, test.code)
+		}
+
+		for _, p := range []string{cpu, mem, trace} {
+			if info, err := os.Stat(p); err != nil || info.Size() == 0 {
+				t.Errorf("%v: profile %s is empty or missing: %v", test.flags, filepath.Base(p), err)
+			}
+		}
+		// names of tasks and regions are stored in trace as strings
+		data, _ := os.ReadFile(trace)
+		for _, region := range []string{"write", "read", "parse", "insert", "flush", "merge"} {
+			if !bytes.Contains(data, []byte(region)) {
+				t.Errorf("%v: trace without %q region", test.flags, region)
+			}
+		}
+	}
+}
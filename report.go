@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"ip_addr_counter/components"
+	"ip_addr_counter/pkg/util"
+)
+
+// result of count printed with -report flag
+type report struct {
+	// id of run, folder of its runs is kept in DstPath with -keep-intermediate
+	RunID   string        `json:"run_id"`
+	// "ips" or "intervals"
+	Mode    string        `json:"mode"`
+	Inputs  []inputReport `json:"inputs"`
+	Lines   uint64        `json:"lines"`
+	Valid   uint64        `json:"valid"`
+	Invalid uint64        `json:"invalid"`
+	// count of unique ips, or count of covered addresses in interval mode
+	Unique  uint64        `json:"unique"`
+
+	WriteSec float64 `json:"write_sec"`
+	ReadSec  float64 `json:"read_sec"`
+	TotalSec float64 `json:"total_sec"`
+
+	Partitions []partitionReport `json:"partitions"`
+	// count and total size of flushed on-disk arrays
+	Runs       int               `json:"runs"`
+	RunBytes   uint64            `json:"run_bytes"`
+
+	PeakRSSBytes     uint64 `json:"peak_rss_bytes"`
+	DiskBytesWritten uint64 `json:"disk_bytes_written"`
+}
+
+type inputReport struct {
+	Name   string `json:"name"`
+	// count of unique ips of input, zero in interval mode
+	Unique uint64 `json:"unique"`
+}
+
+type partitionReport struct {
+	Range    string `json:"range"`
+	// count of values routed into partition while writing
+	Load     uint64 `json:"load"`
+	Runs     int    `json:"runs"`
+	RunBytes uint64 `json:"run_bytes"`
+	// count of values read from runs and unique ones while reading
+	Read     uint64 `json:"read"`
+	Unique   uint64 `json:"unique"`
+}
+
+func newReport(start time.Time, write *components.WriteStats, read *components.ReadStats) *report {
+	r := &report{
+		RunID:            write.RunID,
+		Mode:             "ips",
+		Inputs:           make([]inputReport, len(write.Inputs)),
+		Lines:            write.Lines,
+		Valid:            write.Lines - write.Invalid,
+		Invalid:          write.Invalid,
+		WriteSec:         write.Duration.Seconds(),
+		ReadSec:          read.Duration.Seconds(),
+		TotalSec:         time.Since(start).Seconds(),
+		Partitions:       make([]partitionReport, len(write.Partitions)),
+		PeakRSSBytes:     util.PeakRSS(),
+		DiskBytesWritten: write.WrittenBytes(),
+	}
+
+	for i, name := range write.Inputs {
+		r.Inputs[i].Name = name
+	}
+	for i, p := range write.Partitions {
+		r.Partitions[i] = partitionReport{
+			Range:    components.RangeString(write.Partitioner, i),
+			Load:     p.Load,
+			Runs:     p.Runs,
+			RunBytes: p.RunBytes,
+			Read:     read.Partitions[i].Read,
+			Unique:   read.Partitions[i].Unique,
+		}
+		r.Runs += p.Runs
+		r.RunBytes += p.RunBytes
+	}
+	return r
+}
+
+func printTextReport(w io.Writer, r *report) {
+	if r.Mode == "intervals" {
+		fmt.Fprintln(w, "coveredCount -", r.Unique)
+	} else {
+		if len(r.Inputs) > 1 {
+			for _, in := range r.Inputs {
+				fmt.Fprintln(w, "uniqCount", in.Name, "-", in.Unique)
+			}
+		}
+		fmt.Fprintln(w, "uniqCount -", r.Unique)
+	}
+	if r.Invalid > 0 {
+		fmt.Fprintln(w, "invalid lines -", r.Invalid, "of", r.Lines)
+	}
+	fmt.Fprintln(w, "duration -", time.Duration(r.TotalSec * float64(time.Second)))
+}
+
+// prints value as indented JSON, e.g. report (printJSON[*report])
+func printJSON[T any](w io.Writer, v T) {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	util.PanicIfErr(enc.Encode(v))
+}
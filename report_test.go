@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// json report holds totals, counts of inputs and statistics of partitions
+// consistent with each other
+func TestJSONReport(t *testing.T) {
+	dir := t.TempDir()
+	inputs := []string{}
+	// the second half of ips of the first input are the first half of the second one
+	for n, first := range []int{0, 1500} {
+		lines := &strings.Builder{}
+		for i := range 6000 {
+			fmt.Fprintf(lines, "10.0.%d.%d\n", (first + i / 2) >> 8, (first + i / 2) & 0xff)
+		}
+		lines.WriteString("not an ip\n")
+		input := filepath.Join(dir, fmt.Sprintf("ips%d.txt", n))
+		if err := os.WriteFile(input, []byte(lines.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		inputs = append(inputs, input)
+	}
+
+	for _, test := range []struct {
+		flags   []string
+		mode    string
+		// unique ips of each input, zero in interval mode
+		unique  uint64
+	}{
+		{nil, "ips", 3000},
+		{[]string{"-intervals"}, "intervals", 0},
+	} {
+		args := append([]string{"-report", "json", "-partitions", "3", "-elements", "1000", "-dst", t.TempDir()}, test.flags...)
+		code, out := runCount(t, append(args, inputs...)...)
+		r := &report{}
+		if err := json.Unmarshal([]byte(out), r); code != 0 || err != nil {
+			t.Fatalf("%s: exit code %d, json report: %v", test.mode, code, err)
+		}
+
+		if r.Mode != test.mode || r.Lines != 12002 || r.Valid != 12000 || r.Invalid != 2 || r.Unique != 4500 {
+			t.Errorf(
+				"%s: mode %s, lines %d, valid %d, invalid %d, unique %d, expected 12002 lines, 2 invalid and 4500 unique",
+				test.mode, r.Mode, r.Lines, r.Valid, r.Invalid, r.Unique,
+			)
+		}
+		for i, in := range r.Inputs {
+			if in.Name != inputs[i] || in.Unique != test.unique {
+				t.Errorf("%s: input %d %s with %d unique, expected %s with %d", test.mode, i, in.Name, in.Unique, inputs[i], test.unique)
+			}
+		}
+		if len(r.Partitions) != 3 {
+			t.Fatalf("%s: %d partitions, expected 3", test.mode, len(r.Partitions))
+		}
+
+		load, unique, runs, runBytes := uint64(0), uint64(0), 0, uint64(0)
+		for _, p := range r.Partitions {
+			if p.Range == "" || p.Read > p.Load || p.Unique > p.Read {
+				t.Errorf("%s: partition %+v", test.mode, p)
+			}
+			load += p.Load
+			unique += p.Unique
+			runs += p.Runs
+			runBytes += p.RunBytes
+		}
+		if load != r.Valid || unique != r.Unique || runs != r.Runs || runBytes != r.RunBytes || r.DiskBytesWritten != r.RunBytes {
+			t.Errorf(
+				"%s: partitions sum up to load %d, unique %d, %d runs of %d bytes; report %+v",
+				test.mode, load, unique, runs, runBytes, r,
+			)
+		}
+		if r.Runs < 3 || r.TotalSec < r.WriteSec + r.ReadSec {
+			t.Errorf("%s: %d runs, write %fs, read %fs, total %fs", test.mode, r.Runs, r.WriteSec, r.ReadSec, r.TotalSec)
+		}
+	}
+}
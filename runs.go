@@ -0,0 +1,108 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ip_addr_counter/components"
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// lists, inspects and garbage collects folders of runs in destination folder
+func runs(args []string) int {
+	flags := flag.NewFlagSet("runs", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s runs [list | inspect <id> | gc] [flags]\n", os.Args[0])
+		fmt.Fprintln(flags.Output(), "Folders of active runs (locked by running process) are never removed by gc.")
+		flags.PrintDefaults()
+	}
+
+	// action goes before flags, list by default
+	action := "list"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+
+	dst := flags.String("dst", path.Join(dataFolder, dstFolder), "destination folder with folders of runs")
+	asJSON := flags.Bool("json", false, "print runs as JSON")
+	olderThan := flags.Duration("older-than", 24 * time.Hour, "gc removes finished and abandoned runs started earlier than this duration ago, 0 removes all of them")
+	dryRun := flags.Bool("dry-run", false, "gc prints runs to remove without removing them")
+	setupLog := logFlags(flags)
+	flags.Parse(args)
+	setupLog()
+
+	switch action {
+	case "list":
+		list := components.ListRuns(*dst)
+		if *asJSON {
+			printJSON(os.Stdout, list)
+			return 0
+		}
+		printRunsTable(os.Stdout, list)
+	case "inspect":
+		if flags.NArg() != 1 {
+			usageError(flags, fmt.Errorf("inspect requires id of run"))
+		}
+		rs := components.InspectRun(*dst, flags.Arg(0))
+		if *asJSON {
+			printJSON(os.Stdout, rs)
+			return 0
+		}
+		printRun(os.Stdout, rs)
+	case "gc":
+		removed, freed := 0, uint64(0)
+		for _, rs := range components.ListRuns(*dst) {
+			if rs.Status == components.RunActive || time.Since(rs.Started) < *olderThan {
+				continue
+			}
+			if !*dryRun {
+				if err := components.RemoveRun(rs); err != nil {
+					slog.Warn("run isn't removed", "id", rs.ID, "err", err)
+					continue
+				}
+			}
+			slog.Info("run removed", "id", rs.ID, "status", rs.Status, "bytes", rs.Bytes, "dry_run", *dryRun)
+			fmt.Println(rs.ID)
+			removed++
+			freed += rs.Bytes
+		}
+		slog.Info("runs garbage collected", "removed", removed, "freed", progress.Bytes(freed), "dry_run", *dryRun)
+	default:
+		usageError(flags, fmt.Errorf("unknown action %q", action))
+	}
+	return 0
+}
+
+func printRunsTable(w io.Writer, list []*components.RunStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "id\tstatus\tstarted\tpid\tfiles\tsize\tinputs")
+	for _, rs := range list {
+		fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			rs.ID, rs.Status, rs.Started.Local().Format(time.DateTime), rs.PID,
+			rs.Files, progress.Bytes(rs.Bytes), strings.Join(rs.Inputs, " "),
+		)
+	}
+	util.PanicIfErr(tw.Flush())
+}
+
+func printRun(w io.Writer, rs *components.RunStatus) {
+	fmt.Fprintln(w, "id -", rs.ID)
+	fmt.Fprintln(w, "status -", rs.Status)
+	fmt.Fprintln(w, "dir -", rs.Dir)
+	fmt.Fprintf(w, "process - %d on %s\n", rs.PID, rs.Host)
+	fmt.Fprintln(w, "started -", rs.Started.Local().Format(time.DateTime))
+	if rs.Finished != nil {
+		fmt.Fprintln(w, "finished -", rs.Finished.Local().Format(time.DateTime))
+	}
+	fmt.Fprintln(w, "inputs -", strings.Join(rs.Inputs, " "))
+	fmt.Fprintf(w, "files - %d, %s\n", rs.Files, progress.Bytes(rs.Bytes))
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "ip_addr_counter/pkg/progress"
+
+// SIGUSR1 isn't available, so state can't be dumped on signal
+func dumpOnSignal(recorder *progress.Recorder) (stop func()) {
+	return func() {}
+}
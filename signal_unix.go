@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"log/slog"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"ip_addr_counter/pkg/progress"
+	"ip_addr_counter/pkg/util"
+)
+
+// logs last progress snapshot and memory usage on each SIGUSR1
+// until returned stop is called
+func dumpOnSignal(recorder *progress.Recorder) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+
+	go func() {
+		for range ch {
+			ms := runtime.MemStats{}
+			runtime.ReadMemStats(&ms)
+			attrs := []any{
+				"goroutines", runtime.NumGoroutine(),
+				"heap_bytes", ms.HeapAlloc,
+				"peak_rss_bytes", util.PeakRSS(),
+			}
+			if s, ok := recorder.Last(); ok {
+				attrs = append(attrs, "progress", s)
+			}
+			slog.Info("SIGUSR1 state", attrs...)
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(ch)
+	}
+}
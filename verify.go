@@ -0,0 +1,118 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"ip_addr_counter/components"
+)
+
+// counts unique ips (or covered addresses) with external sort pipeline and
+// with exact reference method, checks partitions and flushed runs. Returns
+// exit code, 1 on any mismatch
+func verify(args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s verify [flags] [ip files, globs, directories, archives]...\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+
+	intervalMode := flags.Bool("intervals", false, "count addresses covered by ranges/CIDRs in ip files")
+	method := flags.String("reference", components.ReferenceAuto, "exact reference method: map, bitmap (512MB) or auto (map for inputs smaller than 16MB)")
+	pipeline := pipelineFlags(flags)
+	setupLog := logFlags(flags)
+	flags.Parse(args)
+	setupLog()
+
+	switch *method {
+	case components.ReferenceAuto, components.ReferenceBitmap:
+	case components.ReferenceMap:
+		if *intervalMode {
+			usageError(flags, fmt.Errorf("map reference method doesn't support intervals"))
+		}
+	default:
+		usageError(flags, fmt.Errorf("unknown reference method %q", *method))
+	}
+
+	// inputs are read twice
+	if slices.Contains(flags.Args(), components.StdinPath) {
+		usageError(flags, fmt.Errorf("standard input can't be verified, since it can be read only once"))
+	}
+
+	start := time.Now()
+	cfg := pipeline(flags.Args())
+	writeCfg := cfg.write
+
+	if !checkPreflight(cfg, *intervalMode) {
+		return 1
+	}
+
+	var write components.WriteStats
+	var unique uint64
+	var uniquePerInput []uint64
+	var errs []error
+
+	slog.Info("verification started", "inputs", len(writeCfg.IPFilePaths), "intervals", *intervalMode)
+	if *intervalMode {
+		result := components.WriteIntervals(writeCfg)
+		read := components.ReadIntervals(&components.ReadIntervalConfigs{
+			ArrayListPerStage:        result.Runs,
+			ParallelArrayReaderCount: cfg.parallelReaders,
+			ArrayIteratorCacheSize:   cfg.arrayCacheSize,
+			ReadLimiter:              writeCfg.ReadLimiter,
+		})
+		write, unique = result.WriteStats, read.CoveredCount
+		errs = components.CheckIntervalRuns(write.Partitioner, result.Runs, cfg.arrayCacheSize)
+		cleanup(cfg, &result.WriteStats, result.Remove)
+	} else {
+		result := components.Write(writeCfg)
+		read := components.Read(&components.ReadConfigs{
+			ArrayListPerStage:        result.Runs,
+			ParallelArrayReaderCount: cfg.parallelReaders,
+			ArrayIteratorCacheSize:   cfg.arrayCacheSize,
+			SourceCount:              len(result.Inputs),
+			ReadLimiter:              writeCfg.ReadLimiter,
+		})
+		write, unique, uniquePerInput = result.WriteStats, read.UniqCount, read.UniqCountPerInput
+		errs = components.CheckRuns(write.Partitioner, result.Runs, cfg.arrayCacheSize)
+		cleanup(cfg, &result.WriteStats, result.Remove)
+	}
+	errs = append(components.CheckPartitions(write.Partitioner), errs...)
+	slog.Info("pipeline finished", "unique", unique, "elapsed", time.Since(start))
+
+	ref := components.Reference(writeCfg, *method, *intervalMode)
+	slog.Info("reference finished", "method", ref.Method, "unique", ref.Unique, "elapsed", ref.Duration)
+
+	mismatch := func(name string, got, expected uint64) {
+		if got != expected {
+			errs = append(errs, fmt.Errorf("%s mismatch: pipeline %d, reference %d", name, got, expected))
+		}
+	}
+	mismatch("lines", write.Lines, ref.Lines)
+	mismatch("invalid lines", write.Invalid, ref.Invalid)
+	mismatch("unique count", unique, ref.Unique)
+	if !slices.Equal(write.Inputs, ref.Inputs) {
+		errs = append(errs, fmt.Errorf("inputs mismatch: pipeline %q, reference %q", write.Inputs, ref.Inputs))
+	} else if ref.UniquePerInput != nil && len(write.Inputs) > 1 {
+		for i, name := range write.Inputs {
+			mismatch("unique count of "+name, uniquePerInput[i], ref.UniquePerInput[i])
+		}
+	}
+
+	fmt.Printf("pipeline unique - %d\n", unique)
+	fmt.Printf("reference unique - %d (%s)\n", ref.Unique, ref.Method)
+	fmt.Printf("lines - %d, invalid - %d\n", write.Lines, write.Invalid)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			slog.Error("verification failed", "err", err)
+		}
+		fmt.Printf("verification failed - %d errors\n", len(errs))
+		return 1
+	}
+	fmt.Println("verification passed")
+	return 0
+}